@@ -7,7 +7,9 @@ replace github.com/aryann/difflib => github.com/k14s/difflib v0.0.0-202001081714
 replace go.starlark.net => github.com/k14s/starlark-go v0.0.0-20200207164905-fd8842955e4e // ytt branch
 
 require (
+	github.com/bmatcuk/doublestar v1.2.1
 	github.com/cppforlife/go-cli-ui v0.0.0-20200108172221-38b12a2f8675
+	github.com/google/go-containerregistry v0.0.0-20190617215043-876b8855d23c
 	github.com/google/uuid v1.1.1
 	github.com/hashicorp/hcl/v2 v2.3.0 // indirect
 	github.com/hashicorp/terraform-config-inspect v0.0.0-20191212124732-c6ae6269b9d7 // indirect
@@ -16,6 +18,9 @@ require (
 	github.com/k14s/terraform-provider-k14s v0.4.0 // indirect
 	github.com/k14s/ytt v0.26.0
 	github.com/mitchellh/go-homedir v1.1.0
+	github.com/spf13/cobra v0.0.3
+	k8s.io/api v0.0.0-20180628040859-072894a440bd
 	k8s.io/apimachinery v0.0.0-20180621070125-103fd098999d
 	k8s.io/client-go v8.0.0+incompatible
+	k8s.io/kube-openapi v0.0.0-20180620173706-91cfa479c814 // indirect
 )
@@ -1,10 +1,26 @@
 package k14s
 
 import (
+	"time"
+
 	cmdcore "github.com/k14s/kapp/pkg/kapp/cmd/core"
+	util "github.com/niallthomson/terraform-provider-k14s/k14s/util"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 )
 
+const (
+	defaultHTTPTimeout = 30 * time.Second
+)
+
 type Config struct {
 	DepsFactory cmdcore.DepsFactory
+	HTTPFetcher *util.HTTPFetcher
+}
+
+// httpFetcher falls back to defaults when the provider was not configured
+func httpFetcher(meta interface{}) *util.HTTPFetcher {
+	if c, ok := meta.(*Config); ok && c.HTTPFetcher != nil {
+		return c.HTTPFetcher
+	}
+	return util.NewHTTPFetcher(defaultHTTPTimeout, util.DefaultHTTPCacheDir())
 }
@@ -0,0 +1,122 @@
+package k14s
+
+import (
+	"github.com/google/uuid"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/niallthomson/terraform-provider-k14s/k14s/kapp"
+)
+
+func datasourceKappDiff() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"app": {
+				Type:        schema.TypeString,
+				Description: "The name of the app",
+				Required:    true,
+			},
+			"namespace": {
+				Type:        schema.TypeString,
+				Description: "The default namespace to operate in",
+				Required:    true,
+			},
+			"config_yaml": {
+				Type:        schema.TypeString,
+				Description: "The config yaml to compare",
+				Optional:    true,
+			},
+			"files": {
+				Type:        schema.TypeList,
+				Description: "The yaml files to compare, HTTP(S) URLs may be pinned with a #sha256=<hex> suffix",
+				Optional:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"manifest": {
+				Type:        schema.TypeSet,
+				Description: "Resources to compare, one YAML or JSON document per entry (same as k14sx_kapp)",
+				Optional:    true,
+				Set:         manifestHash,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: manifestValidateFunc,
+				},
+			},
+			"ytt": {
+				Type:        schema.TypeList,
+				Description: "Render configuration with ytt before comparing (same as k14sx_kapp)",
+				Optional:    true,
+				MaxItems:    1,
+				Elem: &schema.Resource{
+					Schema: yttInputSchema("output_format", "sensitive_kinds", "sensitive_match"),
+				},
+			},
+			"changes": {
+				Type:        schema.TypeString,
+				Description: "kapp's change table",
+				Computed:    true,
+			},
+			"diff": {
+				Type:        schema.TypeString,
+				Description: "Text diff of each change, with Secret data and other kapp diff mask rule matches hidden",
+				Computed:    true,
+			},
+			"summary": {
+				Type:        schema.TypeString,
+				Description: "Summary of changes (e.g. Op: 1 create, 0 delete, 2 update, 0 noop)",
+				Computed:    true,
+			},
+			"operations": {
+				Type:        schema.TypeMap,
+				Description: "Number of changes per operation (add, delete, update, noop)",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeInt,
+				},
+			},
+			"has_changes": {
+				Type:        schema.TypeBool,
+				Description: "Whether deploying would change the cluster",
+				Computed:    true,
+			},
+		},
+		Read: datasourceKappDiffRead,
+	}
+}
+
+// datasourceKappDiffRead calculates what k14sx_kapp would deploy without
+// recording the app or applying changes
+func datasourceKappDiffRead(d *schema.ResourceData, meta interface{}) error {
+	c := meta.(*Config)
+
+	yaml, files, _, err := resourceAppInputs(d, meta)
+	if err != nil {
+		return err
+	}
+
+	result, err := kapp.NewDiffRequest(c.DepsFactory, d.Get("app").(string), d.Get("namespace").(string), yaml, files).Execute()
+	if err != nil {
+		return err
+	}
+
+	operations := map[string]interface{}{}
+	hasChanges := false
+
+	for op, count := range result.Operations {
+		operations[string(op)] = count
+		if count > 0 {
+			hasChanges = true
+		}
+	}
+
+	id := uuid.New().String()
+
+	d.SetId(id)
+	d.Set("changes", result.Changes)
+	d.Set("diff", result.Diff)
+	d.Set("summary", result.Summary)
+	d.Set("operations", operations)
+	d.Set("has_changes", hasChanges)
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package k14s
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/niallthomson/terraform-provider-k14s/k14s/kbld"
+)
+
+func datasourceKbld() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"config_yaml": {
+				Type:        schema.TypeString,
+				Description: "The yaml containing image references to resolve",
+				Required:    true,
+				Sensitive:   true,
+			},
+			"kbld_config": {
+				Type:        schema.TypeList,
+				Description: "kbld Config or ImagesLock documents with image overrides",
+				Optional:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"images_lock": {
+				Type:        schema.TypeString,
+				Description: "kbld ImagesLock document. When set, images are resolved only from it (and kbld_config preresolved overrides) without accessing registries, and any other image is an error",
+				Optional:    true,
+			},
+			"insecure_registries": {
+				Type:        schema.TypeList,
+				Description: "Registries (host[:port]) accessed over plain HTTP",
+				Optional:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"registry_timeout": {
+				Type:        schema.TypeString,
+				Description: "Timeout for a single registry request (e.g. 30s)",
+				Optional:    true,
+				Default:     "30s",
+			},
+			"result": {
+				Type:        schema.TypeString,
+				Description: "Yaml with image references resolved to digests",
+				Computed:    true,
+				Sensitive:   true,
+			},
+			"images": {
+				Type:        schema.TypeMap,
+				Description: "Map of original image reference to resolved digest reference",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"result_images_lock": {
+				Type:        schema.TypeString,
+				Description: "Generated kbld ImagesLock document pinning all resolved images",
+				Computed:    true,
+			},
+		},
+		Read: resourceKbldRead,
+	}
+}
+
+func resourceKbldRead(d *schema.ResourceData, meta interface{}) error {
+	config, err := kbldConfig(d)
+	if err != nil {
+		return err
+	}
+
+	resolver, err := kbldResolver(d)
+	if err != nil {
+		return err
+	}
+
+	result, err := kbld.NewResolveRequest(d.Get("config_yaml").(string), kbld.ResolveOpts{
+		Config:   config,
+		Resolver: resolver,
+	}).Execute()
+	if err != nil {
+		return err
+	}
+
+	id := uuid.New().String()
+
+	d.SetId(id)
+	d.Set("result", string(result.YAML))
+	d.Set("images", result.Images)
+	d.Set("result_images_lock", string(result.ImagesLock))
+
+	return nil
+}
+
+// kbldResolver returns nil in offline mode (images_lock is set)
+func kbldResolver(d *schema.ResourceData) (*kbld.RegistryResolver, error) {
+	if d.Get("images_lock").(string) != "" {
+		return nil, nil
+	}
+
+	timeout, err := time.ParseDuration(d.Get("registry_timeout").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	return kbld.NewRegistryResolver(timeout, expandStringSlice(d.Get("insecure_registries").([]interface{}))), nil
+}
+
+func kbldConfig(d *schema.ResourceData) (kbld.Config, error) {
+	configDocs := expandStringSlice(d.Get("kbld_config").([]interface{}))
+
+	if imagesLock := d.Get("images_lock").(string); imagesLock != "" {
+		configDocs = append(configDocs, imagesLock)
+	}
+
+	return kbld.NewConfigFromYAML([]byte(strings.Join(configDocs, "\n---\n")))
+}
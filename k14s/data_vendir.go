@@ -0,0 +1,136 @@
+package k14s
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/niallthomson/terraform-provider-k14s/k14s/vendir"
+)
+
+const (
+	vendirDefaultWorkingDirRoot = ".terraform/k14sx-vendir"
+	// vendirStaleWorkingDirAge is how long a default working directory can
+	// go without being synced before another read removes it
+	vendirStaleWorkingDirAge = 24 * time.Hour
+)
+
+func datasourceVendir() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"config_yaml": {
+				Type:        schema.TypeString,
+				Description: "vendir Config document. Only directory, manual and inline content sources are supported",
+				Required:    true,
+			},
+			"working_dir": {
+				Type:        schema.TypeString,
+				Description: "Directory that config directories are synced into, defaults to a directory under .terraform/k14sx-vendir derived from config_yaml. Default directories not synced for a day are removed by later reads. Manual contents are taken from here, so set it when using them",
+				Optional:    true,
+				Computed:    true,
+			},
+			"base_dir": {
+				Type:        schema.TypeString,
+				Description: "Directory that relative directory source paths are resolved against (e.g. path.module), defaults to the working directory",
+				Optional:    true,
+			},
+			"paths": {
+				Type:        schema.TypeList,
+				Description: "Paths of synced contents in config order, under working_dir (relative to the Terraform working directory unless working_dir is absolute). Pass them to k14sx_ytt files without base_dir, or set working_dir to an absolute path",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"lock_yaml": {
+				Type:        schema.TypeString,
+				Description: "vendir LockConfig document describing synced contents, including a sha256 digest of each content",
+				Computed:    true,
+			},
+		},
+		Read: resourceVendirRead,
+	}
+}
+
+func resourceVendirRead(d *schema.ResourceData, meta interface{}) error {
+	configYAML := d.Get("config_yaml").(string)
+
+	config, err := vendir.NewConfigFromYAML([]byte(configYAML))
+	if err != nil {
+		return err
+	}
+
+	workingDir := d.Get("working_dir").(string)
+	defaultWorkingDir := workingDir == ""
+
+	if defaultWorkingDir {
+		checksum := sha256.Sum256([]byte(configYAML))
+		workingDir = filepath.Join(filepath.FromSlash(vendirDefaultWorkingDirRoot), hex.EncodeToString(checksum[:8]))
+	}
+
+	result, err := vendir.Sync(config, vendir.SyncOpts{
+		WorkingDir: workingDir,
+		BaseDir:    d.Get("base_dir").(string),
+	})
+	if err != nil {
+		return err
+	}
+
+	if defaultWorkingDir {
+		err = vendirRemoveStaleWorkingDirs(workingDir, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	id := uuid.New().String()
+
+	d.SetId(id)
+	d.Set("working_dir", workingDir)
+	d.Set("paths", result.Paths)
+	d.Set("lock_yaml", string(result.Lock))
+
+	return nil
+}
+
+// vendirRemoveStaleWorkingDirs marks workingDir as synced and removes
+// default working directories next to it that were not synced recently.
+// They are left behind whenever config_yaml changes. Directories of other
+// data sources are synced on every read, so they are never stale.
+func vendirRemoveStaleWorkingDirs(workingDir string, now time.Time) error {
+	err := os.Chtimes(workingDir, now, now)
+	if err != nil {
+		return err
+	}
+
+	rootDir := filepath.Dir(workingDir)
+
+	entries, err := ioutil.ReadDir(rootDir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(rootDir, entry.Name())
+
+		if !entry.IsDir() || path == workingDir || now.Sub(entry.ModTime()) < vendirStaleWorkingDirAge {
+			continue
+		}
+
+		log.Printf("[DEBUG] Removing stale vendir working directory %s", path)
+
+		err := os.RemoveAll(path)
+		if err != nil {
+			return fmt.Errorf("Removing stale vendir working directory '%s': %s", path, err)
+		}
+	}
+
+	return nil
+}
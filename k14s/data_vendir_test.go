@@ -0,0 +1,79 @@
+package k14s
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVendirRemoveStaleWorkingDirs(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "vendir-working-dirs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootDir)
+
+	now := time.Now()
+	staleTime := now.Add(-vendirStaleWorkingDirAge - time.Minute)
+
+	dirTimes := map[string]time.Time{
+		"current": staleTime,
+		"fresh":   now.Add(-time.Hour),
+		"stale":   staleTime,
+	}
+
+	for name, modTime := range dirTimes {
+		dir := filepath.Join(rootDir, name)
+
+		err := os.MkdirAll(filepath.Join(dir, "vendor"), 0700)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.Chtimes(dir, modTime, modTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	staleFile := filepath.Join(rootDir, "file")
+
+	err = ioutil.WriteFile(staleFile, nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chtimes(staleFile, staleTime, staleTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = vendirRemoveStaleWorkingDirs(filepath.Join(rootDir, "current"), now)
+	if err != nil {
+		t.Fatalf("Expected cleanup to succeed: %s", err)
+	}
+
+	entries, err := ioutil.ReadDir(rootDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	if len(names) != 3 || names[0] != "current" || names[1] != "file" || names[2] != "fresh" {
+		t.Fatalf("Expected only the stale directory to be removed, but was %v", names)
+	}
+
+	info, err := os.Stat(filepath.Join(rootDir, "current"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if now.Sub(info.ModTime()) > time.Second {
+		t.Fatalf("Expected synced directory to be marked as recently synced, but was %s", info.ModTime())
+	}
+}
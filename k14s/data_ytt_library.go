@@ -0,0 +1,201 @@
+package k14s
+
+import (
+	"encoding/base64"
+	"fmt"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	filespkg "github.com/k14s/ytt/pkg/files"
+	"github.com/k14s/ytt/pkg/yamlmeta"
+	util "github.com/niallthomson/terraform-provider-k14s/k14s/util"
+)
+
+const (
+	yttPrivateLibraryDir = "_ytt_lib"
+	// yttLibraryModulePath is loaded by templates in place of @ytt:library
+	// to get libraries with their data values applied
+	yttLibraryModulePath = "k14sx-library.star"
+)
+
+// yttLibraryModuleTmpl wraps library.get so that data values from library
+// blocks are passed with with_data_values, after the library's own
+// data values and before any with_data_values calls in templates
+const yttLibraryModuleTmpl = `load("@ytt:base64", "base64")
+load("@ytt:library", ytt_library="library")
+load("@ytt:struct", "struct")
+load("@ytt:yaml", "yaml")
+
+_data_values = {
+%s}
+
+def _get(name):
+  lib = ytt_library.get(name)
+  for values in _data_values.get(name, []):
+    lib = lib.with_data_values(yaml.decode(base64.decode(values)))
+  end
+  return lib
+end
+
+library = struct.make(get=_get)
+`
+
+// yttLibraryFiles returns files for each library block placed under
+// _ytt_lib/<name> so that they can be loaded with library.get(<name>),
+// and a module at /k14sx-library.star that passes library data values
+func yttLibraryFiles(libraryParams []interface{}, baseDir string, fetcher *util.HTTPFetcher) ([]*filespkg.File, error) {
+	if len(libraryParams) == 0 {
+		return nil, nil
+	}
+
+	var files []*filespkg.File
+	var moduleValues strings.Builder
+
+	seenNames := map[string]struct{}{}
+
+	for _, libraryParam := range libraryParams {
+		librarySpec := libraryParam.(map[string]interface{})
+
+		name := librarySpec["name"].(string)
+		if name == "" || name == "." || pathpkg.Clean(name) != name || pathpkg.IsAbs(name) ||
+			name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("Expected library name '%s' to be a clean relative path", name)
+		}
+
+		if _, found := seenNames[name]; found {
+			return nil, fmt.Errorf("Expected library name '%s' to be unique", name)
+		}
+		seenNames[name] = struct{}{}
+
+		libraryDir := pathpkg.Join(yttPrivateLibraryDir, name)
+
+		if path := librarySpec["path"].(string); path != "" {
+			dirFiles, err := yttLibraryDirFiles(path, baseDir, libraryDir, fetcher)
+			if err != nil {
+				return nil, fmt.Errorf("Loading library '%s': %s", name, err)
+			}
+
+			files = append(files, dirFiles...)
+		}
+
+		inlineFiles, err := yttInlineFiles(librarySpec["file"].([]interface{}), libraryDir)
+		if err != nil {
+			return nil, fmt.Errorf("Loading library '%s': %s", name, err)
+		}
+
+		files = append(files, inlineFiles...)
+
+		valuesDocs, err := yttLibraryValues(librarySpec)
+		if err != nil {
+			return nil, fmt.Errorf("Building data values for library '%s': %s", name, err)
+		}
+
+		if len(valuesDocs) > 0 {
+			fmt.Fprintf(&moduleValues, "  %s: [", strconv.Quote(name))
+			for _, valuesDoc := range valuesDocs {
+				fmt.Fprintf(&moduleValues, "%q, ", base64.StdEncoding.EncodeToString([]byte(valuesDoc)))
+			}
+			moduleValues.WriteString("],\n")
+		}
+	}
+
+	moduleFile, err := filespkg.NewFileFromSource(filespkg.NewCachedSource(filespkg.NewBytesSource(
+		yttLibraryModulePath, []byte(fmt.Sprintf(yttLibraryModuleTmpl, moduleValues.String())))))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(files, moduleFile), nil
+}
+
+func yttLibraryDirFiles(path, baseDir, libraryDir string, fetcher *util.HTTPFetcher) ([]*filespkg.File, error) {
+	paths, err := yttResolvePaths(baseDir, []string{path}, fetcher)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := filespkg.NewSortedFilesFromPaths(paths, filespkg.SymlinkAllowOpts{
+		AllowAll:        true,
+		AllowedDstPaths: nil,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		file.MarkRelativePath(pathpkg.Join(libraryDir, filepath.ToSlash(file.RelativePath())))
+	}
+
+	return files, nil
+}
+
+// yttLibraryValues returns YAML documents to be passed to the library
+// with with_data_values, in order
+func yttLibraryValues(librarySpec map[string]interface{}) ([]string, error) {
+	var valuesDocs []string
+
+	if values := librarySpec["values"].(map[string]interface{}); len(values) > 0 {
+		valuesDoc, err := yttValuesDocument(values)
+		if err != nil {
+			return nil, err
+		}
+
+		valuesDocs = append(valuesDocs, valuesDoc)
+	}
+
+	if valuesYAML := librarySpec["values_yaml"].(string); valuesYAML != "" {
+		valuesDocs = append(valuesDocs, valuesYAML)
+	}
+
+	return valuesDocs, nil
+}
+
+// yttValuesDocument builds a YAML document from dotted keys
+// (e.g. all.key1.subkey) with string values
+func yttValuesDocument(values map[string]interface{}) (string, error) {
+	var keys []string
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	root := map[string]interface{}{}
+
+	for _, key := range keys {
+		pieces := strings.Split(key, ".")
+		node := root
+
+		for i, piece := range pieces {
+			if i == len(pieces)-1 {
+				if _, found := node[piece]; found {
+					return "", fmt.Errorf("Expected key '%s' to not conflict with other keys", key)
+				}
+				node[piece] = values[key].(string)
+				break
+			}
+
+			child, found := node[piece]
+			if !found {
+				child = map[string]interface{}{}
+				node[piece] = child
+			}
+
+			childMap, ok := child.(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("Expected key '%s' to not conflict with other keys", key)
+			}
+			node = childMap
+		}
+	}
+
+	valuesBytes, err := yamlmeta.PlainMarshal(root)
+	if err != nil {
+		return "", err
+	}
+
+	return string(valuesBytes), nil
+}
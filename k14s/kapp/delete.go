@@ -1,6 +1,9 @@
 package kapp
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/cppforlife/go-cli-ui/ui"
@@ -12,23 +15,48 @@ import (
 	ctldgraph "github.com/k14s/kapp/pkg/kapp/diffgraph"
 	ctlres "github.com/k14s/kapp/pkg/kapp/resources"
 	util "github.com/niallthomson/terraform-provider-k14s/k14s/util"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type DeletePolicy string
+
+const (
+	// DeletePolicyDelete deletes app resources and the app record
+	DeletePolicyDelete DeletePolicy = "delete"
+	// DeletePolicyOrphan keeps app resources but removes kapp ownership
+	// labels, so that another app can adopt them, and deletes the app record
+	DeletePolicyOrphan DeletePolicy = "orphan"
+	// DeletePolicyKeepAppRecord leaves the app and its resources untouched
+	DeletePolicyKeepAppRecord DeletePolicy = "keep_app_record"
+)
+
+const (
+	associationLabelKey       = "kapp.k14s.io/association"
+	disableLabelScopingAnnKey = "kapp.k14s.io/disable-label-scoping"
 )
 
 type DeleteRequest struct {
 	depsFactory cmdcore.DepsFactory
 	name        string
 	namespace   string
+	policy      DeletePolicy
 }
 
-func NewDeleteRequest(depsFactory cmdcore.DepsFactory, name string, namespace string) *DeleteRequest {
+func NewDeleteRequest(depsFactory cmdcore.DepsFactory, name string, namespace string, policy DeletePolicy) *DeleteRequest {
 	return &DeleteRequest{
 		depsFactory: depsFactory,
 		name:        name,
 		namespace:   namespace,
+		policy:      policy,
 	}
 }
 
 func (r *DeleteRequest) Execute() error {
+	if r.policy == DeletePolicyKeepAppRecord {
+		return nil
+	}
+
 	failingAPIServicesPolicy := &app.FailingAPIServicesPolicy{}
 
 	logger := util.NewStdOutLogger()
@@ -57,6 +85,10 @@ func (r *DeleteRequest) Execute() error {
 		return nil
 	}
 
+	if r.policy == DeletePolicyOrphan {
+		return r.orphan(app, supportObjs)
+	}
+
 	usedGVs, err := app.UsedGVs()
 	if err != nil {
 		return err
@@ -97,6 +129,119 @@ func (r *DeleteRequest) Execute() error {
 	return nil
 }
 
+// orphan removes kapp labels from resources that kapp applied, then
+// deletes the app record. app.Delete() is not used as it expects all
+// labeled resources to be gone.
+func (r *DeleteRequest) orphan(app ctlapp.App, supportObjs app.AppFactorySupportObjs) error {
+	labelSelector, err := app.LabelSelector()
+	if err != nil {
+		return err
+	}
+
+	resources, err := supportObjs.IdentifiedResources.List(labelSelector)
+	if err != nil {
+		return err
+	}
+
+	// Resources created by controllers (e.g. Pods) keep labels from
+	// templates, since label selectors of their owners still match them
+	var appliedResources []ctlres.Resource
+
+	for _, res := range resources {
+		if !res.Transient() {
+			appliedResources = append(appliedResources, res)
+		}
+	}
+
+	err = r.checkOrphanable(appliedResources)
+	if err != nil {
+		return err
+	}
+
+	patch := []byte(fmt.Sprintf(`{"metadata":{"labels":{%q:null,%q:null}}}`, appLabelKey, associationLabelKey))
+
+	for _, res := range appliedResources {
+		_, err := supportObjs.IdentifiedResources.Patch(res, types.MergePatchType, patch)
+		if err != nil {
+			return fmt.Errorf("Removing kapp labels from %s: %s", res.Description(), err)
+		}
+	}
+
+	coreClient, err := r.depsFactory.CoreClient()
+	if err != nil {
+		return err
+	}
+
+	err = ctlapp.NewRecordedAppChanges(r.namespace, r.name, coreClient).DeleteAll()
+	if err != nil {
+		return fmt.Errorf("Deleting app changes: %s", err)
+	}
+
+	err = coreClient.CoreV1().ConfigMaps(r.namespace).Delete(r.name, &metav1.DeleteOptions{})
+	if err != nil {
+		return fmt.Errorf("Deleting app: %s", err)
+	}
+
+	return nil
+}
+
+// checkOrphanable refuses to orphan resources whose selectors or pod
+// templates were scoped with the app label by kapp. Selectors of e.g.
+// Deployments cannot be changed, so they would keep selecting by the old
+// app label, and Pods created from templates would keep carrying it.
+// Checked before patching so that either all resources are orphaned or
+// none are.
+func (r *DeleteRequest) checkOrphanable(resources []ctlres.Resource) error {
+	var descs []string
+
+	for _, res := range resources {
+		paths := scopedLabelPaths(res.DeepCopyRaw(), "")
+		if len(paths) > 0 {
+			descs = append(descs, fmt.Sprintf("%s (%s)", res.Description(), strings.Join(paths, ", ")))
+		}
+	}
+
+	if len(descs) > 0 {
+		return fmt.Errorf("Expected resources to not have label selectors scoped by kapp for delete policy '%s', "+
+			"but found: %s. Use delete policy '%s' or '%s', or redeploy them with the %s annotation first",
+			DeletePolicyOrphan, strings.Join(descs, "; "), DeletePolicyDelete, DeletePolicyKeepAppRecord, disableLabelScopingAnnKey)
+	}
+
+	return nil
+}
+
+// scopedLabelPaths returns paths that hold the app label, other than the
+// resource's own labels
+func scopedLabelPaths(val interface{}, path string) []string {
+	var paths []string
+
+	switch typedVal := val.(type) {
+	case map[string]interface{}:
+		for key, item := range typedVal {
+			itemPath := key
+			if path != "" {
+				itemPath = path + "." + key
+			}
+
+			if key == appLabelKey && path != "metadata.labels" {
+				paths = append(paths, path)
+				continue
+			}
+
+			paths = append(paths, scopedLabelPaths(item, itemPath)...)
+		}
+
+	case []interface{}:
+		for i, item := range typedVal {
+			paths = append(paths, scopedLabelPaths(item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
+
 func (r *DeleteRequest) existingResources(app ctlapp.App,
 	supportObjs app.AppFactorySupportObjs) ([]ctlres.Resource, bool, error) {
 
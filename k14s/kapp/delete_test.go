@@ -0,0 +1,279 @@
+package kapp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	ctlres "github.com/k14s/kapp/pkg/kapp/resources"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const deleteTestLabelValue = "1234"
+
+var deleteTestGVRs = map[string]schema.GroupVersionResource{
+	"ConfigMap":  {Version: "v1", Resource: "configmaps"},
+	"Deployment": {Group: "apps", Version: "v1", Resource: "deployments"},
+}
+
+// newDeleteTestDepsFactory returns clients holding the app record of app
+// 'app' in namespace 'default' and the given app resources
+func newDeleteTestDepsFactory(t *testing.T, objs ...*unstructured.Unstructured) fakeDepsFactory {
+	t.Helper()
+
+	appRecord := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app",
+			Namespace: "default",
+			Labels:    map[string]string{"kapp.k14s.io/is-app": ""},
+		},
+		Data: map[string]string{
+			"spec": `{"labelKey":"` + appLabelKey + `","labelValue":"` + deleteTestLabelValue + `"}`,
+		},
+	}
+
+	coreClient := fake.NewSimpleClientset(appRecord)
+	coreClient.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: metav1.Verbs{"list", "get", "patch"}},
+			},
+		},
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", Kind: "Deployment", Namespaced: true, Verbs: metav1.Verbs{"list", "get", "patch"}},
+			},
+		},
+	}
+
+	var runtimeObjs []runtime.Object
+	for _, obj := range objs {
+		runtimeObjs = append(runtimeObjs, obj)
+	}
+
+	dynamicClient := listingDynamicClient{
+		FakeDynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), runtimeObjs...),
+		objs:              objs,
+	}
+
+	return fakeDepsFactory{coreClient: coreClient, dynamicClient: dynamicClient}
+}
+
+// listingDynamicClient lists the objects it was created with, since the
+// fake client cannot list unstructured objects
+type listingDynamicClient struct {
+	*dynamicfake.FakeDynamicClient
+	objs []*unstructured.Unstructured
+}
+
+type listingResourceClient struct {
+	dynamic.NamespaceableResourceInterface
+	resource  schema.GroupVersionResource
+	namespace string
+	objs      []*unstructured.Unstructured
+}
+
+func (c listingDynamicClient) Resource(resource schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return listingResourceClient{c.FakeDynamicClient.Resource(resource), resource, "", c.objs}
+}
+
+func (c listingResourceClient) Namespace(namespace string) dynamic.ResourceInterface {
+	return listingResourceClient{c.NamespaceableResourceInterface, c.resource, namespace, c.objs}
+}
+
+func (c listingResourceClient) Get(name string, opts metav1.GetOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	return c.NamespaceableResourceInterface.Namespace(c.namespace).Get(name, opts, subresources...)
+}
+
+// Patch applies merge patches, which the fake client does not support
+func (c listingResourceClient) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (*unstructured.Unstructured, error) {
+	if pt != types.MergePatchType {
+		return nil, fmt.Errorf("Expected merge patch, but was %s", pt)
+	}
+
+	client := c.NamespaceableResourceInterface.Namespace(c.namespace)
+
+	obj, err := client.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var patch map[string]interface{}
+
+	err = json.Unmarshal(data, &patch)
+	if err != nil {
+		return nil, err
+	}
+
+	mergePatch(obj.Object, patch)
+
+	return client.Update(obj)
+}
+
+func mergePatch(obj, patch map[string]interface{}) {
+	for key, val := range patch {
+		switch typedVal := val.(type) {
+		case nil:
+			delete(obj, key)
+
+		case map[string]interface{}:
+			objVal, ok := obj[key].(map[string]interface{})
+			if !ok {
+				objVal = map[string]interface{}{}
+				obj[key] = objVal
+			}
+			mergePatch(objVal, typedVal)
+
+		default:
+			obj[key] = val
+		}
+	}
+}
+
+func (c listingResourceClient) List(opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	selector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &unstructured.UnstructuredList{}
+
+	for _, obj := range c.objs {
+		if deleteTestGVRs[obj.GetKind()] != c.resource {
+			continue
+		}
+		if c.namespace != "" && obj.GetNamespace() != c.namespace {
+			continue
+		}
+		if selector.Matches(labels.Set(obj.GetLabels())) {
+			list.Items = append(list.Items, *obj.DeepCopy())
+		}
+	}
+
+	return list, nil
+}
+
+// newDeleteTestResource returns a resource labeled and annotated like kapp
+// applied it
+func newDeleteTestResource(t *testing.T, yaml string) *unstructured.Unstructured {
+	t.Helper()
+
+	res, err := ctlres.NewResourceFromBytes([]byte(yaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj := &unstructured.Unstructured{Object: res.DeepCopyRaw()}
+	obj.SetNamespace("default")
+	obj.SetLabels(map[string]string{appLabelKey: deleteTestLabelValue, associationLabelKey: "v1.abc"})
+	obj.SetAnnotations(map[string]string{
+		"kapp.k14s.io/identity": "v1;default/" + res.APIGroup() + "/" + res.Kind() + "/" + res.Name() + ";" + res.APIVersion(),
+	})
+
+	return obj
+}
+
+const deleteTestDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  selector:
+    matchLabels:
+      app: web
+      kapp.k14s.io/app: "1234"
+  template:
+    metadata:
+      labels:
+        app: web
+        kapp.k14s.io/app: "1234"
+`
+
+func TestDeleteRequestKeepAppRecord(t *testing.T) {
+	configMap := newDeleteTestResource(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n")
+	depsFactory := newDeleteTestDepsFactory(t, configMap)
+
+	err := NewDeleteRequest(depsFactory, "app", "default", DeletePolicyKeepAppRecord).Execute()
+	if err != nil {
+		t.Fatalf("Expected keep_app_record to succeed: %s", err)
+	}
+
+	coreClient := depsFactory.coreClient.(*fake.Clientset)
+	if len(coreClient.Actions()) != 0 {
+		t.Fatalf("Expected keep_app_record to not access the cluster, but was: %#v", coreClient.Actions())
+	}
+
+	dynamicClient := depsFactory.dynamicClient.(listingDynamicClient)
+	if len(dynamicClient.Actions()) != 0 {
+		t.Fatalf("Expected keep_app_record to not access the cluster, but was: %#v", dynamicClient.Actions())
+	}
+}
+
+func TestDeleteRequestOrphan(t *testing.T) {
+	configMap := newDeleteTestResource(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n")
+	depsFactory := newDeleteTestDepsFactory(t, configMap)
+
+	err := NewDeleteRequest(depsFactory, "app", "default", DeletePolicyOrphan).Execute()
+	if err != nil {
+		t.Fatalf("Expected orphan to succeed: %s", err)
+	}
+
+	_, err = depsFactory.coreClient.CoreV1().ConfigMaps("default").Get("app", metav1.GetOptions{})
+	if !errors.IsNotFound(err) {
+		t.Fatalf("Expected app record to be deleted, but was: %v", err)
+	}
+
+	obj, err := depsFactory.dynamicClient.Resource(deleteTestGVRs["ConfigMap"]).Namespace("default").Get("cm", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected orphaned resource to be kept: %s", err)
+	}
+
+	for _, key := range []string{appLabelKey, associationLabelKey} {
+		if _, found := obj.GetLabels()[key]; found {
+			t.Fatalf("Expected label %s to be removed, but was: %#v", key, obj.GetLabels())
+		}
+	}
+}
+
+func TestDeleteRequestOrphanScopedSelectors(t *testing.T) {
+	configMap := newDeleteTestResource(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n")
+	deployment := newDeleteTestResource(t, deleteTestDeployment)
+	depsFactory := newDeleteTestDepsFactory(t, configMap, deployment)
+
+	err := NewDeleteRequest(depsFactory, "app", "default", DeletePolicyOrphan).Execute()
+	if err == nil || !strings.Contains(err.Error(), "spec.selector.matchLabels, spec.template.metadata.labels") {
+		t.Fatalf("Expected orphan of scoped selectors to fail, but was: %v", err)
+	}
+
+	_, err = depsFactory.coreClient.CoreV1().ConfigMaps("default").Get("app", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected app record to be kept: %s", err)
+	}
+
+	// Nothing is orphaned when any resource cannot be
+	for _, expectedObj := range []*unstructured.Unstructured{configMap, deployment} {
+		obj, err := depsFactory.dynamicClient.Resource(deleteTestGVRs[expectedObj.GetKind()]).
+			Namespace("default").Get(expectedObj.GetName(), metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if obj.GetLabels()[appLabelKey] != deleteTestLabelValue {
+			t.Fatalf("Expected %s to keep its app label, but was: %#v", obj.GetName(), obj.GetLabels())
+		}
+	}
+}
@@ -196,6 +196,38 @@ func (r *DeployRequest) calculateAndPresentChanges(existingResources,
 	newResources []ctlres.Resource, conf ctlconf.Conf, supportObjs app.AppFactorySupportObjs, ui ui.UI) (
 	ctlcap.ClusterChangeSet, *ctldgraph.ChangeGraph, bool, string, error) {
 
+	clusterChangeSet, clusterChanges, clusterChangesGraph, err :=
+		r.calculateChanges(existingResources, newResources, conf, supportObjs, ui)
+	if err != nil {
+		return clusterChangeSet, nil, false, "", err
+	}
+
+	changeSetViewOpts := ctlcap.ChangeSetViewOpts{
+		Changes: true,
+		Summary: true,
+		TextDiffViewOpts: ctldiff.TextDiffViewOpts{
+			Context: 1,
+			Mask:    true,
+		},
+	}
+
+	var changesSummary string
+
+	{ // Present cluster changes in UI
+		changeViews := ctlcap.ClusterChangesAsChangeViews(clusterChanges)
+		changeSetView := ctlcap.NewChangeSetView(changeViews, conf.DiffMaskRules(), changeSetViewOpts)
+		changeSetView.Print(ui)
+		changesSummary = changeSetView.Summary()
+	}
+
+	return clusterChangeSet, clusterChangesGraph, (len(clusterChanges) == 0), changesSummary, err
+}
+
+// calculateChanges does not modify the cluster; ui is only used for messages
+func (r *DeployRequest) calculateChanges(existingResources,
+	newResources []ctlres.Resource, conf ctlconf.Conf, supportObjs app.AppFactorySupportObjs, ui ui.UI) (
+	ctlcap.ClusterChangeSet, []*ctlcap.ClusterChange, *ctldgraph.ChangeGraph, error) {
+
 	var clusterChangeSet ctlcap.ClusterChangeSet
 
 	changeSetOpts := ctldiff.ChangeSetOpts{
@@ -223,15 +255,6 @@ func (r *DeployRequest) calculateAndPresentChanges(existingResources,
 		},
 	}
 
-	changeSetViewOpts := ctlcap.ChangeSetViewOpts{
-		Changes: true,
-		Summary: true,
-		TextDiffViewOpts: ctldiff.TextDiffViewOpts{
-			Context: 1,
-			Mask:    true,
-		},
-	}
-
 	{ // Figure out changes for X existing resources -> X new resources
 		changeFactory := ctldiff.NewChangeFactory(conf.RebaseMods(), conf.DiffAgainstLastAppliedFieldExclusionMods())
 		changeSetFactory := ctldiff.NewChangeSetFactory(changeSetOpts, changeFactory)
@@ -240,7 +263,7 @@ func (r *DeployRequest) calculateAndPresentChanges(existingResources,
 			existingResources, newResources, conf.TemplateRules(),
 			changeSetOpts, changeFactory).Calculate()
 		if err != nil {
-			return clusterChangeSet, nil, false, "", err
+			return clusterChangeSet, nil, nil, err
 		}
 
 		msgsUI := cmdcore.NewDedupingMessagesUI(cmdcore.NewPlainMessagesUI(ui))
@@ -259,19 +282,10 @@ func (r *DeployRequest) calculateAndPresentChanges(existingResources,
 
 	clusterChanges, clusterChangesGraph, err := clusterChangeSet.Calculate()
 	if err != nil {
-		return clusterChangeSet, nil, false, "", err
+		return clusterChangeSet, nil, nil, err
 	}
 
-	var changesSummary string
-
-	{ // Present cluster changes in UI
-		changeViews := ctlcap.ClusterChangesAsChangeViews(clusterChanges)
-		changeSetView := ctlcap.NewChangeSetView(changeViews, conf.DiffMaskRules(), changeSetViewOpts)
-		changeSetView.Print(ui)
-		changesSummary = changeSetView.Summary()
-	}
-
-	return clusterChangeSet, clusterChangesGraph, (len(clusterChanges) == 0), changesSummary, err
+	return clusterChangeSet, clusterChanges, clusterChangesGraph, nil
 }
 
 func (r *DeployRequest) nsNames(resources []ctlres.Resource) []string {
@@ -291,15 +305,14 @@ func (r *DeployRequest) nsNames(resources []ctlres.Resource) []string {
 	return names
 }
 
-func (r *DeployRequest) newResources(
-	prep ctlapp.Preparation, labeledResources *ctlres.LabeledResources,
-	resourceFilter ctlres.ResourceFilter) ([]ctlres.Resource, ctlconf.Conf, []string, error) {
-
+// inputResources reads resources from yaml and files, separating out
+// kapp configuration
+func (r *DeployRequest) inputResources() ([]ctlres.Resource, ctlconf.Conf, error) {
 	var newResources []ctlres.Resource
 
 	inlineResources, err := ctlres.NewFileResource(ctlres.NewBytesSource([]byte(r.yaml))).Resources()
 	if err != nil {
-		return nil, ctlconf.Conf{}, nil, err
+		return nil, ctlconf.Conf{}, err
 	}
 
 	newResources = append(newResources, inlineResources...)
@@ -307,20 +320,27 @@ func (r *DeployRequest) newResources(
 	for _, file := range r.files {
 		fileRs, err := ctlres.NewFileResources(file)
 		if err != nil {
-			log.Fatalf("Error create file resources: %s", err)
+			return nil, ctlconf.Conf{}, fmt.Errorf("Reading file '%s': %s", file, err)
 		}
 
 		for _, fileRes := range fileRs {
 			resources, err := fileRes.Resources()
 			if err != nil {
-				log.Fatalf("Error create getting resources from file: %s", err)
+				return nil, ctlconf.Conf{}, fmt.Errorf("Reading resources from file '%s': %s", file, err)
 			}
 
 			newResources = append(newResources, resources...)
 		}
 	}
 
-	newResources, conf, err := ctlconf.NewConfFromResourcesWithDefaults(newResources)
+	return ctlconf.NewConfFromResourcesWithDefaults(newResources)
+}
+
+func (r *DeployRequest) newResources(
+	prep ctlapp.Preparation, labeledResources *ctlres.LabeledResources,
+	resourceFilter ctlres.ResourceFilter) ([]ctlres.Resource, ctlconf.Conf, []string, error) {
+
+	newResources, conf, err := r.inputResources()
 	if err != nil {
 		return nil, ctlconf.Conf{}, nil, err
 	}
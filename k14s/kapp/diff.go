@@ -0,0 +1,158 @@
+package kapp
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	ctlapp "github.com/k14s/kapp/pkg/kapp/app"
+	ctlcap "github.com/k14s/kapp/pkg/kapp/clusterapply"
+	"github.com/k14s/kapp/pkg/kapp/cmd/app"
+	cmdcore "github.com/k14s/kapp/pkg/kapp/cmd/core"
+	ctldiff "github.com/k14s/kapp/pkg/kapp/diff"
+	ctlres "github.com/k14s/kapp/pkg/kapp/resources"
+	util "github.com/niallthomson/terraform-provider-k14s/k14s/util"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	appLabelKey = "kapp.k14s.io/app"
+	// Apps that are not deployed yet do not have a label value; kapp
+	// generates numeric values, so this one does not match any resources
+	newAppLabelValue = "not-deployed"
+)
+
+// newAppLabelLine matches added lines of the text diff that set the
+// placeholder label, which would be replaced with a generated value on deploy
+var newAppLabelLine = regexp.MustCompile(`(?m)^ +\d+ \+ +` + regexp.QuoteMeta(appLabelKey+": "+newAppLabelValue) + `\n`)
+
+type DiffRequest struct {
+	deploy *DeployRequest
+}
+
+type DiffResult struct {
+	// Changes is kapp's change table
+	Changes string
+	// Diff holds text diffs with values matched by diff mask rules hidden
+	Diff       string
+	Summary    string
+	Operations map[ctlcap.ClusterChangeApplyOp]int
+}
+
+func NewDiffRequest(depsFactory cmdcore.DepsFactory, name string, namespace string, yaml string, files []string) *DiffRequest {
+	return &DiffRequest{
+		deploy: NewDeployRequest(depsFactory, name, namespace, yaml, files),
+	}
+}
+
+// Execute calculates changes that a deploy would make, without
+// recording the app or applying changes
+func (r *DiffRequest) Execute() (DiffResult, error) {
+	logger := util.NewStdOutLogger()
+
+	msgsUI := &util.LoggingUI{}
+	defer msgsUI.Flush()
+
+	app, supportObjs, err := app.AppFactory(r.deploy.depsFactory, app.AppFlags{
+		Name: r.deploy.name,
+		NamespaceFlags: cmdcore.NamespaceFlags{
+			Name: r.deploy.namespace,
+		},
+	}, app.ResourceTypesFlags{}, logger)
+	if err != nil {
+		return DiffResult{}, err
+	}
+
+	exists, err := app.Exists()
+	if err != nil {
+		return DiffResult{}, err
+	}
+
+	labelSelector := labels.Set{appLabelKey: newAppLabelValue}.AsSelector()
+
+	if exists {
+		labelSelector, err = app.LabelSelector()
+		if err != nil {
+			return DiffResult{}, err
+		}
+	}
+
+	prepOpts := ctlapp.PrepareResourcesOpts{}
+	prepOpts.DefaultNamespace = r.deploy.namespace
+	// kapp calls this unconditionally
+	prepOpts.BeforeModificationFunc = func(rs []ctlres.Resource) []ctlres.Resource { return rs }
+
+	prep := ctlapp.NewPreparation(supportObjs.ResourceTypes, prepOpts)
+
+	labeledResources := ctlres.NewLabeledResources(labelSelector, supportObjs.IdentifiedResources, logger)
+
+	resourceFilter := ctlres.ResourceFilter{}
+
+	newResources, conf, _, err := r.deploy.newResources(prep, labeledResources, resourceFilter)
+	if err != nil {
+		return DiffResult{}, err
+	}
+
+	existingResources, err := r.deploy.existingResources(newResources, labeledResources, resourceFilter, supportObjs.Apps)
+	if err != nil {
+		return DiffResult{}, err
+	}
+
+	_, clusterChanges, _, err := r.deploy.calculateChanges(existingResources, newResources, conf, supportObjs, msgsUI)
+	if err != nil {
+		return DiffResult{}, err
+	}
+
+	err = prep.ValidateResources(newResources)
+	if err != nil {
+		return DiffResult{}, err
+	}
+
+	result := DiffResult{
+		Operations: map[ctlcap.ClusterChangeApplyOp]int{
+			ctlcap.ClusterChangeApplyOpAdd:    0,
+			ctlcap.ClusterChangeApplyOpDelete: 0,
+			ctlcap.ClusterChangeApplyOpUpdate: 0,
+			ctlcap.ClusterChangeApplyOpNoop:   0,
+		},
+	}
+
+	for _, change := range clusterChanges {
+		result.Operations[change.ApplyOp()]++
+	}
+
+	changeViews := ctlcap.ClusterChangesAsChangeViews(clusterChanges)
+
+	{ // Text diffs only
+		var out bytes.Buffer
+
+		changeSetView := ctlcap.NewChangeSetView(changeViews, conf.DiffMaskRules(), ctlcap.ChangeSetViewOpts{
+			Changes: true,
+			TextDiffViewOpts: ctldiff.TextDiffViewOpts{
+				Context: 1,
+				Mask:    true,
+			},
+		})
+		changeSetView.Print(ui.NewWriterUI(&out, &out, ui.NewNoopLogger()))
+
+		result.Diff = out.String()
+
+		if !exists {
+			result.Diff = newAppLabelLine.ReplaceAllString(result.Diff, "")
+		}
+	}
+
+	{ // Change table and summary
+		var out bytes.Buffer
+
+		changeSetView := ctlcap.NewChangeSetView(changeViews, conf.DiffMaskRules(), ctlcap.ChangeSetViewOpts{
+			Summary: true,
+		})
+		changeSetView.Print(ui.NewWriterUI(&out, &out, ui.NewNoopLogger()))
+
+		result.Changes = out.String()
+		result.Summary = changeSetView.Summary()
+	}
+
+	return result, nil
+}
@@ -0,0 +1,80 @@
+package kapp
+
+import (
+	"strings"
+	"testing"
+
+	ctlcap "github.com/k14s/kapp/pkg/kapp/clusterapply"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const diffTestConfigMap = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+data:
+  key: value
+`
+
+// diffTestMutations returns actions other than reads made by both clients
+func diffTestMutations(depsFactory fakeDepsFactory) []k8stesting.Action {
+	actions := depsFactory.coreClient.(*fake.Clientset).Actions()
+	actions = append(actions, depsFactory.dynamicClient.(listingDynamicClient).FakeDynamicClient.Actions()...)
+
+	var mutations []k8stesting.Action
+	for _, action := range actions {
+		switch action.GetVerb() {
+		case "get", "list", "watch":
+		default:
+			mutations = append(mutations, action)
+		}
+	}
+	return mutations
+}
+
+func TestDiffRequestNewApp(t *testing.T) {
+	depsFactory := newDeleteTestDepsFactory(t)
+
+	result, err := NewDiffRequest(depsFactory, "new-app", "default", diffTestConfigMap, nil).Execute()
+	if err != nil {
+		t.Fatalf("Expected diff to succeed: %s", err)
+	}
+
+	if result.Operations[ctlcap.ClusterChangeApplyOpAdd] != 1 {
+		t.Fatalf("Expected config map to be created, but was %#v", result.Operations)
+	}
+
+	if !strings.Contains(result.Diff, "name: web") {
+		t.Fatalf("Expected diff to show the new config map, but was:\n%s", result.Diff)
+	}
+
+	if strings.Contains(result.Diff, newAppLabelValue) {
+		t.Fatalf("Expected placeholder app label to be left out of the diff, but was:\n%s", result.Diff)
+	}
+
+	if mutations := diffTestMutations(depsFactory); len(mutations) != 0 {
+		t.Fatalf("Expected diff to not change the cluster, but was: %#v", mutations)
+	}
+}
+
+func TestDiffRequestExistingApp(t *testing.T) {
+	existing := newDeleteTestResource(t, diffTestConfigMap)
+	depsFactory := newDeleteTestDepsFactory(t, existing)
+
+	changed := strings.Replace(diffTestConfigMap, "key: value", "key: changed", 1)
+
+	result, err := NewDiffRequest(depsFactory, "app", "default", changed, nil).Execute()
+	if err != nil {
+		t.Fatalf("Expected diff to succeed: %s", err)
+	}
+
+	if result.Operations[ctlcap.ClusterChangeApplyOpUpdate] != 1 || !strings.Contains(result.Diff, "key: changed") {
+		t.Fatalf("Expected config map to be updated, but was %#v:\n%s", result.Operations, result.Diff)
+	}
+
+	if mutations := diffTestMutations(depsFactory); len(mutations) != 0 {
+		t.Fatalf("Expected diff to not change the cluster, but was: %#v", mutations)
+	}
+}
@@ -0,0 +1,64 @@
+package kapp
+
+import (
+	"github.com/k14s/kapp/pkg/kapp/cmd/app"
+	cmdcore "github.com/k14s/kapp/pkg/kapp/cmd/core"
+	ctlres "github.com/k14s/kapp/pkg/kapp/resources"
+	util "github.com/niallthomson/terraform-provider-k14s/k14s/util"
+)
+
+const (
+	// AppliedResAnnKey holds the resource as last applied by kapp
+	AppliedResAnnKey = "kapp.k14s.io/original"
+)
+
+type InspectRequest struct {
+	depsFactory cmdcore.DepsFactory
+	name        string
+	namespace   string
+}
+
+func NewInspectRequest(depsFactory cmdcore.DepsFactory, name string, namespace string) *InspectRequest {
+	return &InspectRequest{
+		depsFactory: depsFactory,
+		name:        name,
+		namespace:   namespace,
+	}
+}
+
+// Execute lists resources that belong to the app, or returns false
+// if the app does not exist
+func (r *InspectRequest) Execute() ([]ctlres.Resource, bool, error) {
+	logger := util.NewStdOutLogger()
+
+	app, supportObjs, err := app.AppFactory(r.depsFactory, app.AppFlags{
+		Name: r.name,
+		NamespaceFlags: cmdcore.NamespaceFlags{
+			Name: r.namespace,
+		},
+	}, app.ResourceTypesFlags{}, logger)
+	if err != nil {
+		return nil, false, err
+	}
+
+	exists, err := app.Exists()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !exists {
+		return nil, false, nil
+	}
+
+	labelSelector, err := app.LabelSelector()
+	if err != nil {
+		return nil, false, err
+	}
+
+	resources, err := supportObjs.IdentifiedResources.List(labelSelector)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return ctlres.ResourceFilter{}.Apply(resources), true, nil
+}
@@ -0,0 +1,53 @@
+package kapp
+
+import (
+	cmdcore "github.com/k14s/kapp/pkg/kapp/cmd/core"
+	ctlres "github.com/k14s/kapp/pkg/kapp/resources"
+	ctlresm "github.com/k14s/kapp/pkg/kapp/resourcesmisc"
+)
+
+type DefaultNamespaceRequest struct {
+	deploy *DeployRequest
+}
+
+func NewDefaultNamespaceRequest(depsFactory cmdcore.DepsFactory, yaml string, files []string) *DefaultNamespaceRequest {
+	return &DefaultNamespaceRequest{
+		deploy: NewDeployRequest(depsFactory, "", "", yaml, files),
+	}
+}
+
+// Execute lists namespaced resources without a namespace, which kapp
+// deploys into the app namespace. Cluster scoped resources (including
+// those of CRDs in the same resources) are not listed.
+func (r *DefaultNamespaceRequest) Execute() ([]string, error) {
+	resources, _, err := r.deploy.inputResources()
+	if err != nil {
+		return nil, err
+	}
+
+	coreClient, err := r.deploy.depsFactory.CoreClient()
+	if err != nil {
+		return nil, err
+	}
+
+	resTypes := ctlresm.NewResourceTypes(resources, ctlres.NewResourceTypesImpl(coreClient, ctlres.ResourceTypesImplOpts{}))
+
+	var descs []string
+
+	for _, res := range resources {
+		if len(res.Namespace()) > 0 {
+			continue
+		}
+
+		isNsed, err := resTypes.IsNamespaced(res)
+		if err != nil {
+			return nil, err
+		}
+
+		if isNsed {
+			descs = append(descs, res.Description())
+		}
+	}
+
+	return descs, nil
+}
@@ -0,0 +1,95 @@
+package kapp
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type fakeDepsFactory struct {
+	coreClient    kubernetes.Interface
+	dynamicClient dynamic.Interface
+}
+
+func (f fakeDepsFactory) DynamicClient() (dynamic.Interface, error) { return f.dynamicClient, nil }
+func (f fakeDepsFactory) CoreClient() (kubernetes.Interface, error) { return f.coreClient, nil }
+
+func newFakeDepsFactory() fakeDepsFactory {
+	coreClient := fake.NewSimpleClientset()
+	coreClient.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+				{Name: "namespaces", Kind: "Namespace", Namespaced: false},
+			},
+		},
+		{
+			GroupVersion: "apiextensions.k8s.io/v1beta1",
+			APIResources: []metav1.APIResource{
+				{Name: "customresourcedefinitions", Kind: "CustomResourceDefinition", Namespaced: false},
+			},
+		},
+	}
+	return fakeDepsFactory{coreClient: coreClient}
+}
+
+func TestDefaultNamespaceRequest(t *testing.T) {
+	yaml := `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: no-ns
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: with-ns
+  namespace: apps
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: apps
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  version: v1
+  scope: Cluster
+  names:
+    kind: Widget
+    plural: widgets
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: cluster-widget
+`
+
+	descs, err := NewDefaultNamespaceRequest(newFakeDepsFactory(), yaml, nil).Execute()
+	if err != nil {
+		t.Fatalf("Expected check to succeed: %s", err)
+	}
+
+	// Widget is not known to the cluster, its scope comes from the CRD
+	if !reflect.DeepEqual(descs, []string{"configmap/no-ns (v1) cluster"}) {
+		t.Fatalf("Expected only the namespaced resource without a namespace, but was %#v", descs)
+	}
+}
+
+func TestDefaultNamespaceRequestUnknownKind(t *testing.T) {
+	yaml := "apiVersion: example.com/v1\nkind: Unknown\nmetadata:\n  name: a\n"
+
+	_, err := NewDefaultNamespaceRequest(newFakeDepsFactory(), yaml, nil).Execute()
+	if err == nil {
+		t.Fatalf("Expected unknown kind to fail")
+	}
+}
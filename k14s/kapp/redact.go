@@ -0,0 +1,59 @@
+package kapp
+
+import (
+	ctlconf "github.com/k14s/kapp/pkg/kapp/config"
+	ctlres "github.com/k14s/kapp/pkg/kapp/resources"
+)
+
+const (
+	// Unlike kapp's diff view, masked values are not numbered, so that
+	// redacted resources stay the same between runs
+	redactedValue = "<-- value not shown"
+)
+
+// RedactedResources parses resources and blanks values matched by kapp's
+// diff mask rules (e.g. Secret data), including rules from kapp Config
+// documents within yaml. kapp Config documents are not returned.
+func RedactedResources(yaml []byte) ([]ctlres.Resource, error) {
+	resources, err := ctlres.NewFileResource(ctlres.NewBytesSource(yaml)).Resources()
+	if err != nil {
+		return nil, err
+	}
+
+	resources, conf, err := ctlconf.NewConfFromResourcesWithDefaults(resources)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []ctlres.Resource
+
+	for _, res := range resources {
+		res = res.DeepCopy()
+
+		for _, rule := range conf.DiffMaskRules() {
+			mod := ctlres.ObjectRefSetMod{
+				ResourceMatcher: ctlres.AnyMatcher{
+					Matchers: ctlconf.ResourceMatchers(rule.ResourceMatchers).AsResourceMatchers(),
+				},
+				Path:            rule.Path,
+				ReplacementFunc: redactValues,
+			}
+
+			err := mod.Apply(res)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		result = append(result, res)
+	}
+
+	return result, nil
+}
+
+func redactValues(typedObj map[string]interface{}) error {
+	for key := range typedObj {
+		typedObj[key] = redactedValue
+	}
+	return nil
+}
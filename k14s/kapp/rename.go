@@ -0,0 +1,239 @@
+package kapp
+
+import (
+	"fmt"
+	"sort"
+
+	ctlapp "github.com/k14s/kapp/pkg/kapp/app"
+	"github.com/k14s/kapp/pkg/kapp/cmd/app"
+	cmdcore "github.com/k14s/kapp/pkg/kapp/cmd/core"
+	util "github.com/niallthomson/terraform-provider-k14s/k14s/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	isChangeLabelKey = "kapp.k14s.io/is-app-change"
+	changeLabelKey   = "kapp.k14s.io/app-change-app"
+)
+
+type RenameRequest struct {
+	depsFactory  cmdcore.DepsFactory
+	name         string
+	namespace    string
+	newName      string
+	newNamespace string
+}
+
+func NewRenameRequest(depsFactory cmdcore.DepsFactory, name, namespace, newName, newNamespace string) *RenameRequest {
+	return &RenameRequest{
+		depsFactory:  depsFactory,
+		name:         name,
+		namespace:    namespace,
+		newName:      newName,
+		newNamespace: newNamespace,
+	}
+}
+
+// Execute moves the app record and its changes, or returns false if the
+// app does not exist. App resources are not modified: they are matched by
+// the label value kept in the app record.
+func (r *RenameRequest) Execute() (bool, error) {
+	app, err := r.app(r.name, r.namespace)
+	if err != nil {
+		return false, err
+	}
+
+	exists, err := app.Exists()
+	if err != nil {
+		return false, err
+	}
+
+	if !exists {
+		return false, nil
+	}
+
+	newApp, err := r.app(r.newName, r.newNamespace)
+	if err != nil {
+		return false, err
+	}
+
+	exists, err = newApp.Exists()
+	if err != nil {
+		return false, err
+	}
+
+	if exists {
+		return false, fmt.Errorf("Expected app '%s' (namespace: %s) to not exist before renaming", r.newName, r.newNamespace)
+	}
+
+	coreClient, err := r.depsFactory.CoreClient()
+	if err != nil {
+		return false, err
+	}
+
+	changes, err := r.changes(coreClient)
+	if err != nil {
+		return false, fmt.Errorf("Listing app changes: %s", err)
+	}
+
+	if r.newNamespace == r.namespace {
+		err = r.rename(app, coreClient, changes)
+	} else {
+		// kapp only renames within a namespace
+		err = r.move(coreClient, changes)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *RenameRequest) app(name, namespace string) (ctlapp.App, error) {
+	app, _, err := app.AppFactory(r.depsFactory, app.AppFlags{
+		Name: name,
+		NamespaceFlags: cmdcore.NamespaceFlags{
+			Name: namespace,
+		},
+	}, app.ResourceTypesFlags{}, util.NewStdOutLogger())
+	return app, err
+}
+
+// changes returns app change records in creation order, since kapp
+// orders them by creation
+func (r *RenameRequest) changes(coreClient kubernetes.Interface) ([]corev1.ConfigMap, error) {
+	listOpts := metav1.ListOptions{
+		LabelSelector: labels.Set{isChangeLabelKey: "", changeLabelKey: r.name}.String(),
+	}
+
+	changes, err := coreClient.CoreV1().ConfigMaps(r.namespace).List(listOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(changes.Items, func(i, j int) bool {
+		return changes.Items[i].CreationTimestamp.Before(&changes.Items[j].CreationTimestamp)
+	})
+
+	return changes.Items, nil
+}
+
+// rename relabels app change records so that they stay part of the app
+// history (kapp's rename leaves them behind), then renames the app.
+// Relabelled changes are reverted if renaming fails.
+func (r *RenameRequest) rename(app ctlapp.App, coreClient kubernetes.Interface, changes []corev1.ConfigMap) error {
+	var relabelled []corev1.ConfigMap
+
+	revert := func(err error) error {
+		for _, change := range relabelled {
+			change.Labels[changeLabelKey] = r.name
+
+			_, revertErr := coreClient.CoreV1().ConfigMaps(r.namespace).Update(&change)
+			if revertErr != nil {
+				return fmt.Errorf("%s (reverting app change '%s' failed: %s)", err, change.Name, revertErr)
+			}
+		}
+		return err
+	}
+
+	for _, change := range changes {
+		change.Labels[changeLabelKey] = r.newName
+
+		updatedChange, err := coreClient.CoreV1().ConfigMaps(r.namespace).Update(&change)
+		if err != nil {
+			return revert(fmt.Errorf("Relabelling app change '%s': %s", change.Name, err))
+		}
+
+		relabelled = append(relabelled, *updatedChange)
+	}
+
+	err := app.Rename(r.newName)
+	if err != nil {
+		return revert(err)
+	}
+
+	return nil
+}
+
+// move copies the app record and its changes into the new namespace
+// before deleting the originals. Nothing is deleted until all copies
+// exist, and copies are deleted again if any of them cannot be created.
+func (r *RenameRequest) move(coreClient kubernetes.Interface, changes []corev1.ConfigMap) error {
+	appRecord, err := coreClient.CoreV1().ConfigMaps(r.namespace).Get(r.name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Getting app: %s", err)
+	}
+
+	// Change names are kept since the app record refers to its last change
+	newConfigMaps := []corev1.ConfigMap{r.movedConfigMap(*appRecord, r.newName)}
+
+	for _, change := range changes {
+		change.Labels[changeLabelKey] = r.newName
+		newConfigMaps = append(newConfigMaps, r.movedConfigMap(change, change.Name))
+	}
+
+	for _, configMap := range newConfigMaps {
+		_, err := coreClient.CoreV1().ConfigMaps(r.newNamespace).Get(configMap.Name, metav1.GetOptions{})
+		if err == nil {
+			return fmt.Errorf("Expected config map '%s' (namespace: %s) to not exist before moving app",
+				configMap.Name, r.newNamespace)
+		}
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("Checking config map '%s' (namespace: %s): %s", configMap.Name, r.newNamespace, err)
+		}
+	}
+
+	var created []string
+
+	revert := func(err error) error {
+		for _, name := range created {
+			deleteErr := coreClient.CoreV1().ConfigMaps(r.newNamespace).Delete(name, &metav1.DeleteOptions{})
+			if deleteErr != nil {
+				return fmt.Errorf("%s (deleting config map '%s' failed: %s)", err, name, deleteErr)
+			}
+		}
+		return err
+	}
+
+	for _, configMap := range newConfigMaps {
+		_, err := coreClient.CoreV1().ConfigMaps(r.newNamespace).Create(&configMap)
+		if err != nil {
+			return revert(fmt.Errorf("Creating config map '%s' (namespace: %s): %s", configMap.Name, r.newNamespace, err))
+		}
+
+		created = append(created, configMap.Name)
+	}
+
+	err = coreClient.CoreV1().ConfigMaps(r.namespace).Delete(r.name, &metav1.DeleteOptions{})
+	if err != nil {
+		return revert(fmt.Errorf("Deleting app: %s", err))
+	}
+
+	// Once the app record is gone the app only exists in the new namespace,
+	// so left over changes no longer belong to any app
+
+	for _, change := range changes {
+		err = coreClient.CoreV1().ConfigMaps(r.namespace).Delete(change.Name, &metav1.DeleteOptions{})
+		if err != nil {
+			return fmt.Errorf("Deleting app change '%s': %s", change.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *RenameRequest) movedConfigMap(configMap corev1.ConfigMap, name string) corev1.ConfigMap {
+	return corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   r.newNamespace,
+			Labels:      configMap.Labels,
+			Annotations: configMap.Annotations,
+		},
+		Data: configMap.Data,
+	}
+}
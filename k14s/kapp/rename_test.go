@@ -0,0 +1,161 @@
+package kapp
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newRenameTestClient returns a client holding app 'app' in namespace
+// 'default' with two changes, and any extra objects
+func newRenameTestClient(extraObjs ...runtime.Object) *fake.Clientset {
+	objs := []runtime.Object{
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "app",
+				Namespace: "default",
+				Labels:    map[string]string{"kapp.k14s.io/is-app": ""},
+			},
+			Data: map[string]string{
+				"spec": `{"labelKey":"` + appLabelKey + `","labelValue":"1234","lastChangeName":"app-change-2"}`,
+			},
+		},
+	}
+
+	for _, name := range []string{"app-change-1", "app-change-2"} {
+		objs = append(objs, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{isChangeLabelKey: "", changeLabelKey: "app"},
+			},
+			Data: map[string]string{"spec": "{}"},
+		})
+	}
+
+	return fake.NewSimpleClientset(append(objs, extraObjs...)...)
+}
+
+// renameTestConfigMaps returns names of config maps in the namespace with
+// the change label value, if any
+func renameTestConfigMaps(t *testing.T, coreClient *fake.Clientset, namespace string) map[string]string {
+	t.Helper()
+
+	configMaps, err := coreClient.CoreV1().ConfigMaps(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Expected config maps to be listed: %s", err)
+	}
+
+	result := map[string]string{}
+	for _, configMap := range configMaps.Items {
+		result[configMap.Name] = configMap.Labels[changeLabelKey]
+	}
+	return result
+}
+
+func TestRenameRequestMove(t *testing.T) {
+	coreClient := newRenameTestClient()
+
+	renamed, err := NewRenameRequest(fakeDepsFactory{coreClient: coreClient}, "app", "default", "new-app", "other").Execute()
+	if err != nil || !renamed {
+		t.Fatalf("Expected app to be moved, but was: %t, %v", renamed, err)
+	}
+
+	if configMaps := renameTestConfigMaps(t, coreClient, "default"); len(configMaps) != 0 {
+		t.Fatalf("Expected nothing to be left in the previous namespace, but was: %v", configMaps)
+	}
+
+	expected := map[string]string{"new-app": "", "app-change-1": "new-app", "app-change-2": "new-app"}
+	if configMaps := renameTestConfigMaps(t, coreClient, "other"); fmt.Sprint(configMaps) != fmt.Sprint(expected) {
+		t.Fatalf("Expected app and changes to be moved, but was: %v", configMaps)
+	}
+}
+
+func TestRenameRequestMoveExistingTarget(t *testing.T) {
+	existingChange := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "app-change-2", Namespace: "other"}}
+	coreClient := newRenameTestClient(existingChange)
+
+	_, err := NewRenameRequest(fakeDepsFactory{coreClient: coreClient}, "app", "default", "app", "other").Execute()
+	if err == nil || !strings.Contains(err.Error(), "'app-change-2' (namespace: other) to not exist") {
+		t.Fatalf("Expected existing config map to be detected, but was: %v", err)
+	}
+
+	for _, action := range coreClient.Actions() {
+		if action.GetVerb() != "get" && action.GetVerb() != "list" {
+			t.Fatalf("Expected nothing to be modified, but was: %#v", action)
+		}
+	}
+}
+
+func TestRenameRequestMoveCreateFailure(t *testing.T) {
+	coreClient := newRenameTestClient()
+
+	coreClient.PrependReactor("create", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		configMap := action.(k8stesting.CreateAction).GetObject().(*corev1.ConfigMap)
+		if configMap.Name == "app-change-2" {
+			return true, nil, fmt.Errorf("quota exceeded")
+		}
+		return false, nil, nil
+	})
+
+	_, err := NewRenameRequest(fakeDepsFactory{coreClient: coreClient}, "app", "default", "app", "other").Execute()
+	if err == nil || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Fatalf("Expected create failure, but was: %v", err)
+	}
+
+	if configMaps := renameTestConfigMaps(t, coreClient, "other"); len(configMaps) != 0 {
+		t.Fatalf("Expected created config maps to be deleted, but was: %v", configMaps)
+	}
+
+	expected := map[string]string{"app": "", "app-change-1": "app", "app-change-2": "app"}
+	if configMaps := renameTestConfigMaps(t, coreClient, "default"); fmt.Sprint(configMaps) != fmt.Sprint(expected) {
+		t.Fatalf("Expected app to be left as it was, but was: %v", configMaps)
+	}
+}
+
+func TestRenameRequestRename(t *testing.T) {
+	coreClient := newRenameTestClient()
+
+	renamed, err := NewRenameRequest(fakeDepsFactory{coreClient: coreClient}, "app", "default", "new-app", "default").Execute()
+	if err != nil || !renamed {
+		t.Fatalf("Expected app to be renamed, but was: %t, %v", renamed, err)
+	}
+
+	expected := map[string]string{"new-app": "", "app-change-1": "new-app", "app-change-2": "new-app"}
+	if configMaps := renameTestConfigMaps(t, coreClient, "default"); fmt.Sprint(configMaps) != fmt.Sprint(expected) {
+		t.Fatalf("Expected app and changes to be renamed, but was: %v", configMaps)
+	}
+}
+
+func TestRenameRequestRenameFailure(t *testing.T) {
+	coreClient := newRenameTestClient()
+
+	coreClient.PrependReactor("create", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("quota exceeded")
+	})
+
+	_, err := NewRenameRequest(fakeDepsFactory{coreClient: coreClient}, "app", "default", "new-app", "default").Execute()
+	if err == nil || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Fatalf("Expected rename failure, but was: %v", err)
+	}
+
+	expected := map[string]string{"app": "", "app-change-1": "app", "app-change-2": "app"}
+	if configMaps := renameTestConfigMaps(t, coreClient, "default"); fmt.Sprint(configMaps) != fmt.Sprint(expected) {
+		t.Fatalf("Expected relabelled changes to be reverted, but was: %v", configMaps)
+	}
+}
+
+func TestRenameRequestMissingApp(t *testing.T) {
+	coreClient := fake.NewSimpleClientset()
+
+	renamed, err := NewRenameRequest(fakeDepsFactory{coreClient: coreClient}, "app", "default", "new-app", "other").Execute()
+	if err != nil || renamed {
+		t.Fatalf("Expected missing app to not be renamed, but was: %t, %v", renamed, err)
+	}
+}
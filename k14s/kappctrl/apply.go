@@ -0,0 +1,131 @@
+package kappctrl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	pollInterval = 2 * time.Second
+)
+
+type ApplyRequest struct {
+	client  dynamic.Interface
+	kind    Kind
+	obj     *unstructured.Unstructured
+	timeout time.Duration
+}
+
+func NewApplyRequest(client dynamic.Interface, kind Kind, obj *unstructured.Unstructured, timeout time.Duration) *ApplyRequest {
+	return &ApplyRequest{
+		client:  client,
+		kind:    kind,
+		obj:     obj,
+		timeout: timeout,
+	}
+}
+
+// Execute creates or updates the custom resource and waits until
+// kapp-controller reports ReconcileSucceeded for its latest spec. Paused
+// and canceled resources are not reconciled, so they are not waited for.
+func (r *ApplyRequest) Execute() (Status, error) {
+	resClient := r.client.Resource(r.kind.Resource).Namespace(r.obj.GetNamespace())
+
+	existing, err := resClient.Get(r.obj.GetName(), metav1.GetOptions{})
+	var applied *unstructured.Unstructured
+
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return Status{}, fmt.Errorf("Getting %s '%s': %s", r.kind.Name, r.obj.GetName(), err)
+		}
+
+		applied, err = resClient.Create(r.obj)
+		if err != nil {
+			return Status{}, fmt.Errorf("Creating %s '%s': %s", r.kind.Name, r.obj.GetName(), err)
+		}
+	} else {
+		// Keep metadata managed by others (e.g. finalizers, resourceVersion)
+		existing.Object["spec"] = r.obj.Object["spec"]
+
+		applied, err = resClient.Update(existing)
+		if err != nil {
+			return Status{}, fmt.Errorf("Updating %s '%s': %s", r.kind.Name, r.obj.GetName(), err)
+		}
+	}
+
+	if isSuspended(r.obj) {
+		log.Printf("[DEBUG] Not waiting for %s '%s' to reconcile as it is paused or canceled", r.kind.Name, r.obj.GetName())
+		return newStatus(applied), nil
+	}
+
+	return r.wait()
+}
+
+func (r *ApplyRequest) wait() (Status, error) {
+	resClient := r.client.Resource(r.kind.Resource).Namespace(r.obj.GetNamespace())
+	deadline := time.Now().Add(r.timeout)
+
+	for {
+		obj, err := resClient.Get(r.obj.GetName(), metav1.GetOptions{})
+		if err != nil {
+			return Status{}, fmt.Errorf("Getting %s '%s': %s", r.kind.Name, r.obj.GetName(), err)
+		}
+
+		if isObserved(obj) {
+			if _, found := findCondition(obj, conditionReconcileSucceeded); found {
+				return newStatus(obj), nil
+			}
+			if cond, found := findCondition(obj, conditionReconcileFailed); found {
+				return newStatus(obj), failureErr(obj, cond)
+			}
+		}
+
+		status := newStatus(obj)
+
+		if time.Now().After(deadline) {
+			return status, fmt.Errorf("Timed out waiting for %s '%s' (namespace: %s) to reconcile: %s",
+				r.kind.Name, obj.GetName(), obj.GetNamespace(), status.FriendlyDescription)
+		}
+
+		log.Printf("[DEBUG] Waiting for %s '%s' to reconcile: %s", r.kind.Name, obj.GetName(), status.FriendlyDescription)
+
+		time.Sleep(pollInterval)
+	}
+}
+
+// Get returns the custom resource spec and status, or false if it does not exist
+func Get(client dynamic.Interface, kind Kind, name, namespace string) (map[string]interface{}, Status, bool, error) {
+	obj, err := client.Resource(kind.Resource).Namespace(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, Status{}, false, nil
+		}
+		return nil, Status{}, false, fmt.Errorf("Getting %s '%s': %s", kind.Name, name, err)
+	}
+
+	spec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+
+	return spec, newStatus(obj), true, nil
+}
+
+// SpecHash returns sha256 of the spec serialized as JSON (with sorted keys),
+// so specs built by the provider and read from the cluster are comparable
+func SpecHash(spec map[string]interface{}) (string, error) {
+	specBytes, err := json.Marshal(spec)
+	if err != nil {
+		return "", fmt.Errorf("Serializing spec: %s", err)
+	}
+
+	checksum := sha256.Sum256(specBytes)
+
+	return hex.EncodeToString(checksum[:]), nil
+}
@@ -0,0 +1,302 @@
+package kappctrl
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func init() {
+	pollInterval = time.Millisecond
+}
+
+// fakeController stands in for kapp-controller: it bumps generation on
+// spec changes and lets tests update status whenever the resource is read
+type fakeController struct {
+	client  *fake.FakeDynamicClient
+	tracker k8stesting.ObjectTracker
+
+	creates int
+	updates int
+	gets    int
+
+	// reconcile updates the stored object before it is returned by a get
+	reconcile func(obj *unstructured.Unstructured, gets int)
+	// keepOnDelete emulates a finalizer, the object stays until removed
+	keepOnDelete bool
+}
+
+func newFakeController(objects ...*unstructured.Unstructured) *fakeController {
+	scheme := runtime.NewScheme()
+	tracker := k8stesting.NewObjectTracker(scheme, serializer.NewCodecFactory(scheme).UniversalDecoder())
+
+	for _, obj := range objects {
+		err := tracker.Create(AppKind.Resource, obj, obj.GetNamespace())
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	c := &fakeController{
+		client:  fake.NewSimpleDynamicClient(scheme),
+		tracker: tracker,
+	}
+
+	c.client.PrependReactor("*", "*", k8stesting.ObjectReaction(tracker))
+	c.client.PrependReactor("create", "*", c.reactCreate)
+	c.client.PrependReactor("update", "*", c.reactUpdate)
+	c.client.PrependReactor("get", "*", c.reactGet)
+	c.client.PrependReactor("delete", "*", c.reactDelete)
+
+	return c
+}
+
+func (c *fakeController) reactCreate(action k8stesting.Action) (bool, runtime.Object, error) {
+	c.creates++
+
+	// Each reactor gets a copy of the action, so objects are stored here
+	obj := action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured)
+	obj.SetGeneration(1)
+
+	return true, obj.DeepCopy(), c.tracker.Create(action.GetResource(), obj, action.GetNamespace())
+}
+
+func (c *fakeController) reactUpdate(action k8stesting.Action) (bool, runtime.Object, error) {
+	c.updates++
+
+	obj := action.(k8stesting.UpdateAction).GetObject().(*unstructured.Unstructured)
+
+	existing, err := c.tracker.Get(action.GetResource(), obj.GetNamespace(), obj.GetName())
+	if err != nil {
+		return true, nil, err
+	}
+
+	existingSpec, _, _ := unstructured.NestedMap(existing.(*unstructured.Unstructured).Object, "spec")
+	newSpec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+
+	if hash(existingSpec) != hash(newSpec) {
+		obj.SetGeneration(obj.GetGeneration() + 1)
+	}
+
+	return true, obj.DeepCopy(), c.tracker.Update(action.GetResource(), obj, action.GetNamespace())
+}
+
+func (c *fakeController) reactGet(action k8stesting.Action) (bool, runtime.Object, error) {
+	c.gets++
+
+	if c.reconcile == nil {
+		return false, nil, nil
+	}
+
+	getAction := action.(k8stesting.GetAction)
+
+	stored, err := c.tracker.Get(action.GetResource(), action.GetNamespace(), getAction.GetName())
+	if err != nil {
+		return false, nil, nil
+	}
+
+	obj := stored.(*unstructured.Unstructured)
+	c.reconcile(obj, c.gets)
+
+	err = c.tracker.Update(action.GetResource(), obj, action.GetNamespace())
+
+	// Tracker keeps obj, so callers must not be able to modify it
+	return true, obj.DeepCopy(), err
+}
+
+func (c *fakeController) reactDelete(action k8stesting.Action) (bool, runtime.Object, error) {
+	return c.keepOnDelete, nil, nil
+}
+
+func hash(spec map[string]interface{}) string {
+	specHash, err := SpecHash(spec)
+	if err != nil {
+		panic(err)
+	}
+	return specHash
+}
+
+func setStatus(obj *unstructured.Unstructured, observedGeneration int64, condType, message string) {
+	status := map[string]interface{}{
+		"observedGeneration":  observedGeneration,
+		"friendlyDescription": condType,
+	}
+
+	if condType != "" {
+		status["conditions"] = []interface{}{
+			map[string]interface{}{"type": condType, "status": "True", "message": message},
+		}
+	}
+
+	obj.Object["status"] = status
+}
+
+func testApp(spec map[string]interface{}) *unstructured.Unstructured {
+	return AppKind.NewObject("app", "default", spec)
+}
+
+func TestApplyCreate(t *testing.T) {
+	c := newFakeController()
+	c.reconcile = func(obj *unstructured.Unstructured, gets int) {
+		if gets < 3 {
+			return
+		}
+		setStatus(obj, obj.GetGeneration(), conditionReconcileSucceeded, "")
+	}
+
+	status, err := NewApplyRequest(c.client, AppKind, testApp(map[string]interface{}{"syncPeriod": "1m"}), time.Minute).Execute()
+	if err != nil {
+		t.Fatalf("Expected apply to succeed: %s", err)
+	}
+
+	if c.creates != 1 || c.updates != 0 {
+		t.Fatalf("Expected create without update, but was %d creates and %d updates", c.creates, c.updates)
+	}
+	if status.FriendlyDescription != conditionReconcileSucceeded {
+		t.Fatalf("Expected status to be returned, but was %#v", status)
+	}
+
+	spec, _, found, err := Get(c.client, AppKind, "app", "default")
+	if err != nil || !found {
+		t.Fatalf("Expected app to be found: %v", err)
+	}
+	if spec["syncPeriod"] != "1m" {
+		t.Fatalf("Expected spec to be read back, but was %#v", spec)
+	}
+}
+
+func TestApplyUpdateWaitsForObservedGeneration(t *testing.T) {
+	existing := testApp(map[string]interface{}{"syncPeriod": "1m"})
+	existing.SetGeneration(1)
+	existing.SetFinalizers([]string{"finalizers.kapp-ctrl.k14s.io/delete"})
+	setStatus(existing, 1, conditionReconcileSucceeded, "")
+
+	c := newFakeController(existing)
+
+	c.reconcile = func(obj *unstructured.Unstructured, gets int) {
+		// Previous generation keeps reporting success until the new one is observed
+		if gets >= 4 {
+			setStatus(obj, obj.GetGeneration(), conditionReconcileFailed, "new spec failed")
+		}
+	}
+
+	_, err := NewApplyRequest(c.client, AppKind, testApp(map[string]interface{}{"syncPeriod": "2m"}), time.Minute).Execute()
+	if err == nil || !strings.Contains(err.Error(), "new spec failed") {
+		t.Fatalf("Expected failure of observed generation, but was: %v", err)
+	}
+
+	if c.creates != 0 || c.updates != 1 {
+		t.Fatalf("Expected update without create, but was %d creates and %d updates", c.creates, c.updates)
+	}
+
+	// First get checks existence, then polls ignore the succeeded
+	// condition of generation 1 until generation 2 is observed
+	if c.gets != 4 {
+		t.Fatalf("Expected to wait for generation 2 to be observed, but app was read %d times", c.gets)
+	}
+
+	stored, _, _, err := Get(c.client, AppKind, "app", "default")
+	if err != nil || stored["syncPeriod"] != "2m" {
+		t.Fatalf("Expected spec to be updated, but was %#v (%v)", stored, err)
+	}
+
+	obj, err := c.client.Resource(AppKind.Resource).Namespace("default").Get("app", metav1.GetOptions{})
+	if err != nil || len(obj.GetFinalizers()) != 1 {
+		t.Fatalf("Expected update to keep existing metadata, but was %#v (%v)", obj, err)
+	}
+}
+
+func TestApplyReconcileFailedMessage(t *testing.T) {
+	c := newFakeController()
+	c.reconcile = func(obj *unstructured.Unstructured, gets int) {
+		setStatus(obj, obj.GetGeneration(), conditionReconcileFailed, "Reconcile failed")
+		obj.Object["status"].(map[string]interface{})["deploy"] = map[string]interface{}{
+			"stderr": "kapp: Error: forbidden",
+		}
+	}
+
+	_, err := NewApplyRequest(c.client, AppKind, testApp(map[string]interface{}{}), time.Minute).Execute()
+	if err == nil {
+		t.Fatalf("Expected apply to fail")
+	}
+
+	for _, expected := range []string{"ReconcileFailed", "Reconcile failed", "deploy stderr: kapp: Error: forbidden"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Expected error to contain '%s', but was: %s", expected, err)
+		}
+	}
+
+	c.reconcile = func(obj *unstructured.Unstructured, gets int) {
+		setStatus(obj, obj.GetGeneration(), conditionReconcileFailed, "Reconcile failed")
+		obj.Object["status"].(map[string]interface{})["usefulErrorMessage"] = "useful message"
+	}
+
+	_, err = NewApplyRequest(c.client, AppKind, testApp(map[string]interface{}{"syncPeriod": "1m"}), time.Minute).Execute()
+	if err == nil || !strings.Contains(err.Error(), "useful message") {
+		t.Fatalf("Expected error to contain useful error message, but was: %v", err)
+	}
+}
+
+func TestApplyTimeout(t *testing.T) {
+	c := newFakeController()
+	c.reconcile = func(obj *unstructured.Unstructured, gets int) {
+		setStatus(obj, 0, "", "")
+		obj.Object["status"].(map[string]interface{})["friendlyDescription"] = "Reconciling"
+	}
+
+	status, err := NewApplyRequest(c.client, AppKind, testApp(map[string]interface{}{}), 20*time.Millisecond).Execute()
+	if err == nil || !strings.Contains(err.Error(), "Timed out") || !strings.Contains(err.Error(), "Reconciling") {
+		t.Fatalf("Expected apply to time out with status, but was: %v", err)
+	}
+
+	if status.FriendlyDescription != "Reconciling" {
+		t.Fatalf("Expected last status to be returned, but was %#v", status)
+	}
+}
+
+func TestApplySuspendedDoesNotWait(t *testing.T) {
+	for _, field := range []string{"paused", "canceled"} {
+		existing := testApp(map[string]interface{}{"syncPeriod": "1m"})
+		existing.SetGeneration(1)
+		setStatus(existing, 1, conditionReconcileSucceeded, "")
+
+		c := newFakeController(existing)
+
+		// kapp-controller never observes the new generation
+		c.reconcile = func(obj *unstructured.Unstructured, gets int) {}
+
+		status, err := NewApplyRequest(c.client, AppKind, testApp(map[string]interface{}{field: true}), 20*time.Millisecond).Execute()
+		if err != nil {
+			t.Fatalf("Expected %s apply to not wait, but was: %s", field, err)
+		}
+
+		if c.updates != 1 || c.gets != 1 {
+			t.Fatalf("Expected %s app to be updated without polling, but was %d updates and %d gets", field, c.updates, c.gets)
+		}
+
+		if status.FriendlyDescription != conditionReconcileSucceeded {
+			t.Fatalf("Expected current status to be returned, but was %#v", status)
+		}
+
+		stored, _, _, err := Get(c.client, AppKind, "app", "default")
+		if err != nil || stored[field] != true {
+			t.Fatalf("Expected spec to be updated, but was %#v (%v)", stored, err)
+		}
+	}
+}
+
+func TestGetNotFound(t *testing.T) {
+	c := newFakeController()
+
+	_, _, found, err := Get(c.client, AppKind, "app", "default")
+	if err != nil || found {
+		t.Fatalf("Expected app to not be found, but was %t (%v)", found, err)
+	}
+}
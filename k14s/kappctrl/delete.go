@@ -0,0 +1,70 @@
+package kappctrl
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+)
+
+type DeleteRequest struct {
+	client    dynamic.Interface
+	kind      Kind
+	name      string
+	namespace string
+	timeout   time.Duration
+}
+
+func NewDeleteRequest(client dynamic.Interface, kind Kind, name, namespace string, timeout time.Duration) *DeleteRequest {
+	return &DeleteRequest{
+		client:    client,
+		kind:      kind,
+		name:      name,
+		namespace: namespace,
+		timeout:   timeout,
+	}
+}
+
+// Execute deletes the custom resource and waits until kapp-controller has
+// deleted the deployed resources and removed its finalizer
+func (r *DeleteRequest) Execute() error {
+	resClient := r.client.Resource(r.kind.Resource).Namespace(r.namespace)
+
+	err := resClient.Delete(r.name, &metav1.DeleteOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("Deleting %s '%s': %s", r.kind.Name, r.name, err)
+	}
+
+	deadline := time.Now().Add(r.timeout)
+
+	for {
+		obj, err := resClient.Get(r.name, metav1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			return fmt.Errorf("Getting %s '%s': %s", r.kind.Name, r.name, err)
+		}
+
+		if cond, found := findCondition(obj, conditionDeleteFailed); found {
+			return failureErr(obj, cond)
+		}
+
+		status := newStatus(obj)
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out waiting for %s '%s' (namespace: %s) to be deleted: %s",
+				r.kind.Name, r.name, r.namespace, status.FriendlyDescription)
+		}
+
+		log.Printf("[DEBUG] Waiting for %s '%s' to be deleted: %s", r.kind.Name, r.name, status.FriendlyDescription)
+
+		time.Sleep(pollInterval)
+	}
+}
@@ -0,0 +1,69 @@
+package kappctrl
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDelete(t *testing.T) {
+	existing := testApp(map[string]interface{}{})
+	c := newFakeController(existing)
+	c.keepOnDelete = true
+	c.reconcile = func(obj *unstructured.Unstructured, gets int) {
+		// Finalizer is removed once deployed resources are deleted
+		if gets >= 3 {
+			c.keepOnDelete = false
+			c.tracker.Delete(AppKind.Resource, obj.GetNamespace(), obj.GetName())
+		}
+	}
+
+	err := NewDeleteRequest(c.client, AppKind, "app", "default", time.Minute).Execute()
+	if err != nil {
+		t.Fatalf("Expected delete to succeed: %s", err)
+	}
+
+	if c.gets < 3 {
+		t.Fatalf("Expected delete to wait for finalizer, but app was read %d times", c.gets)
+	}
+
+	// Deleting a missing app succeeds
+	err = NewDeleteRequest(c.client, AppKind, "app", "default", time.Minute).Execute()
+	if err != nil {
+		t.Fatalf("Expected delete of missing app to succeed: %s", err)
+	}
+}
+
+func TestDeleteFailed(t *testing.T) {
+	c := newFakeController(testApp(map[string]interface{}{}))
+	c.keepOnDelete = true
+	c.reconcile = func(obj *unstructured.Unstructured, gets int) {
+		setStatus(obj, obj.GetGeneration(), conditionDeleteFailed, "Delete failed")
+		obj.Object["status"].(map[string]interface{})["deploy"] = map[string]interface{}{
+			"error": "Deleting app: timed out",
+		}
+	}
+
+	err := NewDeleteRequest(c.client, AppKind, "app", "default", time.Minute).Execute()
+	if err == nil {
+		t.Fatalf("Expected delete to fail")
+	}
+
+	for _, expected := range []string{"DeleteFailed", "Delete failed", "deploy error: Deleting app: timed out"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Expected error to contain '%s', but was: %s", expected, err)
+		}
+	}
+}
+
+func TestDeleteTimeout(t *testing.T) {
+	c := newFakeController(testApp(map[string]interface{}{}))
+	c.keepOnDelete = true
+
+	err := NewDeleteRequest(c.client, AppKind, "app", "default", 20*time.Millisecond).Execute()
+	if err == nil || !strings.Contains(err.Error(), "Timed out") {
+		t.Fatalf("Expected delete to time out, but was: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package kappctrl
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Kind describes a kapp-controller custom resource that reports
+// reconciliation through status conditions
+type Kind struct {
+	Name     string
+	Resource schema.GroupVersionResource
+}
+
+var (
+	AppKind = Kind{
+		Name:     "App",
+		Resource: schema.GroupVersionResource{Group: "kappctrl.k14s.io", Version: "v1alpha1", Resource: "apps"},
+	}
+	PackageInstallKind = Kind{
+		Name:     "PackageInstall",
+		Resource: schema.GroupVersionResource{Group: "packaging.carvel.dev", Version: "v1alpha1", Resource: "packageinstalls"},
+	}
+
+	Kinds = []Kind{AppKind, PackageInstallKind}
+)
+
+func KindByName(name string) (Kind, error) {
+	for _, kind := range Kinds {
+		if kind.Name == name {
+			return kind, nil
+		}
+	}
+	return Kind{}, fmt.Errorf("Expected kind to be App or PackageInstall, but was '%s'", name)
+}
+
+func (k Kind) APIVersion() string {
+	return k.Resource.GroupVersion().String()
+}
+
+// NewObject builds a custom resource with the given spec
+func (k Kind) NewObject(name, namespace string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": k.APIVersion(),
+			"kind":       k.Name,
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": namespace,
+			},
+			"spec": spec,
+		},
+	}
+}
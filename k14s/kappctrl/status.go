@@ -0,0 +1,105 @@
+package kappctrl
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	conditionReconcileFailed    = "ReconcileFailed"
+	conditionReconcileSucceeded = "ReconcileSucceeded"
+	conditionDeleteFailed       = "DeleteFailed"
+)
+
+// Status is the subset of App/PackageInstall status surfaced to users
+type Status struct {
+	FriendlyDescription string
+	UsefulErrorMessage  string
+}
+
+type condition struct {
+	Type    string
+	Status  string
+	Message string
+}
+
+func newStatus(obj *unstructured.Unstructured) Status {
+	friendlyDesc, _, _ := unstructured.NestedString(obj.Object, "status", "friendlyDescription")
+	usefulErrMsg, _, _ := unstructured.NestedString(obj.Object, "status", "usefulErrorMessage")
+
+	return Status{
+		FriendlyDescription: friendlyDesc,
+		UsefulErrorMessage:  usefulErrMsg,
+	}
+}
+
+// isObserved returns true once the controller has seen the latest spec,
+// so that conditions do not describe a previous generation
+func isObserved(obj *unstructured.Unstructured) bool {
+	observedGen, found, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if !found {
+		return false
+	}
+	return observedGen >= obj.GetGeneration()
+}
+
+// isSuspended returns true if the spec stops kapp-controller from
+// reconciling it (paused stops future reconciles, canceled also the current one)
+func isSuspended(obj *unstructured.Unstructured) bool {
+	paused, _, _ := unstructured.NestedBool(obj.Object, "spec", "paused")
+	canceled, _, _ := unstructured.NestedBool(obj.Object, "spec", "canceled")
+
+	return paused || canceled
+}
+
+func findCondition(obj *unstructured.Unstructured, condType string) (condition, bool) {
+	conds, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+
+	for _, cond := range conds {
+		typedCond, ok := cond.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		result := condition{}
+		result.Type, _ = typedCond["type"].(string)
+		result.Status, _ = typedCond["status"].(string)
+		result.Message, _ = typedCond["message"].(string)
+
+		if result.Type == condType && result.Status == "True" {
+			return result, true
+		}
+	}
+
+	return condition{}, false
+}
+
+// failureErr builds an error from a failed condition, including details
+// that kapp-controller records for each reconcile step
+func failureErr(obj *unstructured.Unstructured, cond condition) error {
+	msgs := []string{}
+
+	if cond.Message != "" {
+		msgs = append(msgs, cond.Message)
+	}
+
+	status := newStatus(obj)
+
+	if status.UsefulErrorMessage != "" {
+		msgs = append(msgs, status.UsefulErrorMessage)
+	} else {
+		for _, step := range []string{"fetch", "template", "deploy"} {
+			for _, field := range []string{"error", "stderr"} {
+				val, _, _ := unstructured.NestedString(obj.Object, "status", step, field)
+				if val != "" {
+					msgs = append(msgs, fmt.Sprintf("%s %s: %s", step, field, val))
+				}
+			}
+		}
+	}
+
+	return fmt.Errorf("%s '%s' (namespace: %s) %s: %s",
+		obj.GetKind(), obj.GetName(), obj.GetNamespace(), cond.Type, strings.Join(msgs, "\n"))
+}
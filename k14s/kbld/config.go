@@ -0,0 +1,168 @@
+package kbld
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/k14s/ytt/pkg/yamlmeta"
+	util "github.com/niallthomson/terraform-provider-k14s/k14s/util"
+)
+
+const (
+	configAPIVersion = "kbld.k14s.io/v1alpha1"
+	configKind       = "Config"
+	imagesLockKind   = "ImagesLock"
+)
+
+// ImageOverride mirrors kbld's override entries in Config and ImagesLock
+// documents. Preresolved images are used as is without contacting a registry.
+type ImageOverride struct {
+	Image       string
+	NewImage    string
+	Preresolved bool
+}
+
+type Config struct {
+	Overrides []ImageOverride
+}
+
+// NewConfigFromYAML parses kbld Config and ImagesLock documents
+func NewConfigFromYAML(data []byte) (Config, error) {
+	docSet, err := yamlmeta.NewDocumentSetFromBytes(data, yamlmeta.DocSetOpts{WithoutMeta: true})
+	if err != nil {
+		return Config{}, fmt.Errorf("Parsing kbld config: %s", err)
+	}
+
+	var config Config
+
+	for _, doc := range docSet.Items {
+		if doc.IsEmpty() {
+			continue
+		}
+
+		unorderedDoc, err := util.UnorderedStringMaps(doc.AsInterface())
+		if err != nil {
+			return Config{}, fmt.Errorf("Parsing kbld config: %s", err)
+		}
+
+		obj, ok := unorderedDoc.(map[string]interface{})
+		if !ok {
+			return Config{}, fmt.Errorf("Expected kbld config document to be a map")
+		}
+
+		if obj["apiVersion"] != configAPIVersion {
+			return Config{}, fmt.Errorf("Expected kbld config apiVersion to be '%s', but was '%v'", configAPIVersion, obj["apiVersion"])
+		}
+
+		switch obj["kind"] {
+		case configKind:
+			overrides, err := newOverrides(obj["overrides"], false)
+			if err != nil {
+				return Config{}, err
+			}
+			config.Overrides = append(config.Overrides, overrides...)
+
+		case imagesLockKind:
+			overrides, err := newOverrides(obj["overrides"], true)
+			if err != nil {
+				return Config{}, err
+			}
+			config.Overrides = append(config.Overrides, overrides...)
+
+		default:
+			return Config{}, fmt.Errorf("Expected kbld config kind to be '%s' or '%s', but was '%v'", configKind, imagesLockKind, obj["kind"])
+		}
+	}
+
+	return config, nil
+}
+
+func newOverrides(val interface{}, preresolved bool) ([]ImageOverride, error) {
+	if val == nil {
+		return nil, nil
+	}
+
+	items, ok := val.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Expected kbld config overrides to be an array")
+	}
+
+	var overrides []ImageOverride
+
+	for _, item := range items {
+		itemMap, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Expected kbld config override to be a map")
+		}
+
+		override := ImageOverride{Preresolved: preresolved}
+
+		override.Image, _ = itemMap["image"].(string)
+		override.NewImage, _ = itemMap["newImage"].(string)
+
+		if typedPreresolved, ok := itemMap["preresolved"].(bool); ok {
+			override.Preresolved = typedPreresolved
+		}
+
+		if override.Image == "" || override.NewImage == "" {
+			return nil, fmt.Errorf("Expected kbld config override to specify image and newImage")
+		}
+
+		overrides = append(overrides, override)
+	}
+
+	return overrides, nil
+}
+
+func (c Config) Find(image string) (ImageOverride, bool) {
+	// Later overrides win, same as kbld
+	for i := len(c.Overrides) - 1; i >= 0; i-- {
+		if c.Overrides[i].Image == image {
+			return c.Overrides[i], true
+		}
+	}
+	return ImageOverride{}, false
+}
+
+type imagesLockDoc struct {
+	APIVersion string                  `yaml:"apiVersion"`
+	Kind       string                  `yaml:"kind"`
+	Overrides  []imagesLockDocOverride `yaml:"overrides"`
+}
+
+type imagesLockDocOverride struct {
+	Image       string `yaml:"image"`
+	NewImage    string `yaml:"newImage"`
+	Preresolved bool   `yaml:"preresolved"`
+}
+
+// ImagesLockYAML generates a kbld ImagesLock document for resolved images
+// (original reference to digest reference), sorted by original reference
+func ImagesLockYAML(images map[string]string) ([]byte, error) {
+	var originals []string
+	for image := range images {
+		originals = append(originals, image)
+	}
+	sort.Strings(originals)
+
+	doc := imagesLockDoc{
+		APIVersion: configAPIVersion,
+		Kind:       imagesLockKind,
+		Overrides:  []imagesLockDocOverride{},
+	}
+
+	for _, image := range originals {
+		doc.Overrides = append(doc.Overrides, imagesLockDocOverride{
+			Image:       image,
+			NewImage:    images[image],
+			Preresolved: true,
+		})
+	}
+
+	docBytes, err := yamlmeta.PlainMarshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("Generating images lock: %s", err)
+	}
+
+	return docBytes, nil
+}
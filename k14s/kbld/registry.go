@@ -0,0 +1,71 @@
+package kbld
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// RegistryResolver resolves tags to digests with go-containerregistry,
+// which kbld also uses for registry access. Credentials come from the
+// docker config (~/.docker/config.json or $DOCKER_CONFIG) including
+// credential helpers; registries without an entry are accessed anonymously.
+type RegistryResolver struct {
+	transport          http.RoundTripper
+	keychain           authn.Keychain
+	insecureRegistries map[string]struct{}
+}
+
+func NewRegistryResolver(timeout time.Duration, insecureRegistries []string) *RegistryResolver {
+	insecure := map[string]struct{}{}
+	for _, registry := range insecureRegistries {
+		insecure[registry] = struct{}{}
+	}
+
+	return &RegistryResolver{
+		transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: timeout}).DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+		},
+		keychain:           authn.DefaultKeychain,
+		insecureRegistries: insecure,
+	}
+}
+
+// ParseReference parses image references the same way as docker
+// (e.g. nginx is index.docker.io/library/nginx:latest)
+func (r *RegistryResolver) ParseReference(image string) (name.Reference, error) {
+	ref, err := name.ParseReference(image, name.WeakValidation)
+	if err != nil {
+		return nil, fmt.Errorf("Parsing image '%s': %s", image, err)
+	}
+
+	if r != nil {
+		if _, found := r.insecureRegistries[ref.Context().RegistryStr()]; found {
+			return name.ParseReference(image, name.WeakValidation, name.Insecure)
+		}
+	}
+
+	return ref, nil
+}
+
+// Resolve returns a digest reference (registry/repository@sha256:...)
+func (r *RegistryResolver) Resolve(ref name.Reference) (string, error) {
+	if digestRef, ok := ref.(name.Digest); ok {
+		return digestRef.Name(), nil
+	}
+
+	desc, err := remote.Get(ref, remote.WithTransport(r.transport), remote.WithAuthFromKeychain(r.keychain))
+	if err != nil {
+		return "", fmt.Errorf("Resolving image '%s': %s", ref.Name(), err)
+	}
+
+	return ref.Context().Name() + "@" + desc.Digest.String(), nil
+}
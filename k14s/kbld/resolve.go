@@ -0,0 +1,149 @@
+package kbld
+
+import (
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/k14s/ytt/pkg/yamlmeta"
+)
+
+const (
+	imageKey = "image"
+)
+
+// ResolveOpts configures resolution. Without a Resolver no registry is
+// contacted and every image must be covered by a preresolved override
+// (e.g. from an ImagesLock) or already be a digest reference.
+type ResolveOpts struct {
+	Config   Config
+	Resolver *RegistryResolver
+}
+
+type ResolveRequest struct {
+	yaml string
+	opts ResolveOpts
+}
+
+type ResolveResult struct {
+	YAML []byte
+	// Images maps original image references to resolved digest references
+	Images map[string]string
+	// ImagesLock is an ImagesLock document pinning Images
+	ImagesLock []byte
+}
+
+func NewResolveRequest(yaml string, opts ResolveOpts) *ResolveRequest {
+	return &ResolveRequest{
+		yaml: yaml,
+		opts: opts,
+	}
+}
+
+// Execute rewrites values of 'image' keys to digest references, using
+// config overrides first, same as kbld does
+func (r *ResolveRequest) Execute() (*ResolveResult, error) {
+	docSet, err := yamlmeta.NewDocumentSetFromBytes([]byte(r.yaml), yamlmeta.DocSetOpts{WithoutMeta: true})
+	if err != nil {
+		return nil, fmt.Errorf("Parsing yaml: %s", err)
+	}
+
+	images := map[string]string{}
+
+	for _, doc := range docSet.Items {
+		err := r.visit(doc, images)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resultBytes, err := docSet.AsBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	imagesLock, err := ImagesLockYAML(images)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResolveResult{
+		YAML:       resultBytes,
+		Images:     images,
+		ImagesLock: imagesLock,
+	}, nil
+}
+
+func (r *ResolveRequest) visit(node interface{}, images map[string]string) error {
+	switch typedNode := node.(type) {
+	case *yamlmeta.Map:
+		for _, item := range typedNode.Items {
+			if key, ok := item.Key.(string); ok && key == imageKey {
+				if image, ok := item.Value.(string); ok {
+					resolved, err := r.resolve(image, images)
+					if err != nil {
+						return err
+					}
+					item.Value = resolved
+					continue
+				}
+			}
+
+			err := r.visit(item.Value, images)
+			if err != nil {
+				return err
+			}
+		}
+
+	case yamlmeta.Node:
+		for _, val := range typedNode.GetValues() {
+			err := r.visit(val, images)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *ResolveRequest) resolve(image string, images map[string]string) (string, error) {
+	if resolved, found := images[image]; found {
+		return resolved, nil
+	}
+
+	resolved, err := r.resolveUncached(image)
+	if err != nil {
+		return "", err
+	}
+
+	images[image] = resolved
+
+	return resolved, nil
+}
+
+func (r *ResolveRequest) resolveUncached(image string) (string, error) {
+	original := image
+
+	if override, found := r.opts.Config.Find(image); found {
+		if override.Preresolved {
+			return override.NewImage, nil
+		}
+		image = override.NewImage
+	}
+
+	// A nil resolver still parses references
+	ref, err := r.opts.Resolver.ParseReference(image)
+	if err != nil {
+		return "", err
+	}
+
+	if r.opts.Resolver == nil {
+		digestRef, ok := ref.(name.Digest)
+		if !ok {
+			return "", fmt.Errorf("Expected image '%s' to be present in images lock as registries are not accessed in offline mode", original)
+		}
+		return digestRef.Name(), nil
+	}
+
+	return r.opts.Resolver.Resolve(ref)
+}
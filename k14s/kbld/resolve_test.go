@@ -0,0 +1,310 @@
+package kbld
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testManifest = `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json"}`
+	testToken    = "test-token"
+)
+
+// testRegistry is a minimal registry stand-in serving one manifest for
+// every tag in tags, optionally behind bearer token authentication
+type testRegistry struct {
+	server *httptest.Server
+	tags   map[string]string
+
+	// basicAuth, when set, is required by the token endpoint
+	basicAuth    string
+	authRequired bool
+
+	manifestRequests int
+	tokenRequests    int
+}
+
+func newTestRegistry(t *testing.T, tags map[string]string) *testRegistry {
+	reg := &testRegistry{tags: tags}
+	reg.server = httptest.NewServer(http.HandlerFunc(reg.handle))
+	return reg
+}
+
+func (r *testRegistry) Host() string {
+	return strings.TrimPrefix(r.server.URL, "http://")
+}
+
+func (r *testRegistry) Digest(tag string) string {
+	checksum := sha256.Sum256([]byte(r.tags[tag]))
+	return "sha256:" + hex.EncodeToString(checksum[:])
+}
+
+func (r *testRegistry) handle(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		r.tokenRequests++
+		if r.basicAuth != "" {
+			user, pass, _ := req.BasicAuth()
+			if user+":"+pass != r.basicAuth {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		fmt.Fprintf(w, `{"token":%q}`, testToken)
+		return
+	}
+
+	if r.authRequired && req.Header.Get("Authorization") != "Bearer "+testToken {
+		// Quoted scope with a comma must not break challenge parsing
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+			`Bearer realm="%s/token",service="test-registry",scope="repository:app:pull,push"`, r.server.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if req.URL.Path == "/v2/" {
+		return
+	}
+
+	prefix := "/v2/app/manifests/"
+	if !strings.HasPrefix(req.URL.Path, prefix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	r.manifestRequests++
+
+	manifest, found := r.tags[strings.TrimPrefix(req.URL.Path, prefix)]
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"errors":[{"code":"MANIFEST_UNKNOWN","message":"manifest unknown"}]}`)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+	fmt.Fprint(w, manifest)
+}
+
+func resolveYAML(t *testing.T, yaml string, opts ResolveOpts) (*ResolveResult, error) {
+	t.Helper()
+	return NewResolveRequest(yaml, opts).Execute()
+}
+
+func TestResolveTagToDigest(t *testing.T) {
+	reg := newTestRegistry(t, map[string]string{"1.0": testManifest})
+	defer reg.server.Close()
+
+	image := reg.Host() + "/app:1.0"
+
+	result, err := resolveYAML(t, "spec:\n  containers:\n  - image: "+image+"\n  - image: "+image+"\n", ResolveOpts{
+		Resolver: NewRegistryResolver(5*time.Second, nil),
+	})
+	if err != nil {
+		t.Fatalf("Expected resolution to succeed: %s", err)
+	}
+
+	expected := reg.Host() + "/app@" + reg.Digest("1.0")
+
+	if result.Images[image] != expected {
+		t.Fatalf("Expected image to resolve to '%s', but was '%s'", expected, result.Images[image])
+	}
+	if strings.Count(string(result.YAML), "image: "+expected) != 2 {
+		t.Fatalf("Expected both images to be replaced, but was: %s", result.YAML)
+	}
+	if reg.manifestRequests != 1 {
+		t.Fatalf("Expected repeated images to be resolved once, but manifest was requested %d times", reg.manifestRequests)
+	}
+	if !strings.Contains(string(result.ImagesLock), "newImage: "+expected) {
+		t.Fatalf("Expected images lock to pin resolved image, but was: %s", result.ImagesLock)
+	}
+}
+
+func TestResolveUnknownTag(t *testing.T) {
+	reg := newTestRegistry(t, map[string]string{})
+	defer reg.server.Close()
+
+	_, err := resolveYAML(t, "image: "+reg.Host()+"/app:missing\n", ResolveOpts{
+		Resolver: NewRegistryResolver(5*time.Second, nil),
+	})
+	if err == nil || !strings.Contains(err.Error(), "Resolving image") {
+		t.Fatalf("Expected resolution error, but was: %v", err)
+	}
+}
+
+func TestResolveRetriesWithToken(t *testing.T) {
+	reg := newTestRegistry(t, map[string]string{"1.0": testManifest})
+	reg.authRequired = true
+	reg.basicAuth = "user:secret"
+	defer reg.server.Close()
+
+	configDir, err := ioutil.TempDir("", "kbld-docker-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(configDir)
+
+	dockerConfig := fmt.Sprintf(`{"auths":{%q:{"username":"user","password":"secret"}}}`, reg.Host())
+
+	err = ioutil.WriteFile(filepath.Join(configDir, "config.json"), []byte(dockerConfig), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prevDockerConfig, hadDockerConfig := os.LookupEnv("DOCKER_CONFIG")
+	os.Setenv("DOCKER_CONFIG", configDir)
+	defer func() {
+		if hadDockerConfig {
+			os.Setenv("DOCKER_CONFIG", prevDockerConfig)
+		} else {
+			os.Unsetenv("DOCKER_CONFIG")
+		}
+	}()
+
+	result, err := resolveYAML(t, "image: "+reg.Host()+"/app:1.0\n", ResolveOpts{
+		Resolver: NewRegistryResolver(5*time.Second, nil),
+	})
+	if err != nil {
+		t.Fatalf("Expected resolution to succeed: %s", err)
+	}
+
+	if result.Images[reg.Host()+"/app:1.0"] != reg.Host()+"/app@"+reg.Digest("1.0") {
+		t.Fatalf("Expected image to be resolved, but was: %#v", result.Images)
+	}
+	if reg.tokenRequests == 0 {
+		t.Fatalf("Expected token to be requested")
+	}
+
+	// Without docker config credentials token endpoint refuses access
+	os.Setenv("DOCKER_CONFIG", filepath.Join(configDir, "missing"))
+
+	_, err = resolveYAML(t, "image: "+reg.Host()+"/app:1.0\n", ResolveOpts{
+		Resolver: NewRegistryResolver(5*time.Second, nil),
+	})
+	if err == nil {
+		t.Fatalf("Expected resolution to fail without credentials")
+	}
+}
+
+func TestResolveTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(2 * time.Second)
+	}))
+	defer server.Close()
+
+	_, err := resolveYAML(t, "image: "+strings.TrimPrefix(server.URL, "http://")+"/app:1.0\n", ResolveOpts{
+		Resolver: NewRegistryResolver(100*time.Millisecond, nil),
+	})
+	if err == nil {
+		t.Fatalf("Expected resolution to time out")
+	}
+}
+
+func TestResolveConfigOverrides(t *testing.T) {
+	reg := newTestRegistry(t, map[string]string{
+		"1.0": testManifest,
+		"2.0": testManifest + " ",
+	})
+	defer reg.server.Close()
+
+	lockedDigest := "sha256:" + strings.Repeat("a", 64)
+
+	config, err := NewConfigFromYAML([]byte(fmt.Sprintf(`
+apiVersion: kbld.k14s.io/v1alpha1
+kind: Config
+overrides:
+- image: app
+  newImage: %[1]s/app:1.0
+- image: app
+  newImage: %[1]s/app:2.0
+- image: pinned
+  newImage: example.com/pinned@%[2]s
+  preresolved: true
+---
+apiVersion: kbld.k14s.io/v1alpha1
+kind: ImagesLock
+overrides:
+- image: locked
+  newImage: example.com/locked@%[2]s
+`, reg.Host(), lockedDigest)))
+	if err != nil {
+		t.Fatalf("Expected config to parse: %s", err)
+	}
+
+	result, err := resolveYAML(t, "a:\n  image: app\nb:\n  image: pinned\nc:\n  image: locked\n", ResolveOpts{
+		Config:   config,
+		Resolver: NewRegistryResolver(5*time.Second, nil),
+	})
+	if err != nil {
+		t.Fatalf("Expected resolution to succeed: %s", err)
+	}
+
+	expected := map[string]string{
+		// Later overrides win
+		"app":    reg.Host() + "/app@" + reg.Digest("2.0"),
+		"pinned": "example.com/pinned@" + lockedDigest,
+		"locked": "example.com/locked@" + lockedDigest,
+	}
+
+	for image, expectedRef := range expected {
+		if result.Images[image] != expectedRef {
+			t.Fatalf("Expected image '%s' to resolve to '%s', but was '%s'", image, expectedRef, result.Images[image])
+		}
+	}
+
+	if reg.manifestRequests != 1 {
+		t.Fatalf("Expected only non-preresolved image to be looked up, but manifest was requested %d times", reg.manifestRequests)
+	}
+}
+
+func TestResolveOffline(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("b", 64)
+
+	config, err := NewConfigFromYAML([]byte(`
+apiVersion: kbld.k14s.io/v1alpha1
+kind: ImagesLock
+overrides:
+- image: app:1.0
+  newImage: example.com/app@` + digest + `
+`))
+	if err != nil {
+		t.Fatalf("Expected images lock to parse: %s", err)
+	}
+
+	result, err := resolveYAML(t, "a:\n  image: app:1.0\nb:\n  image: nginx@"+digest+"\n", ResolveOpts{Config: config})
+	if err != nil {
+		t.Fatalf("Expected offline resolution to succeed: %s", err)
+	}
+
+	if result.Images["nginx@"+digest] != "index.docker.io/library/nginx@"+digest {
+		t.Fatalf("Expected digest reference to be kept, but was: %#v", result.Images)
+	}
+
+	_, err = resolveYAML(t, "image: app:2.0\n", ResolveOpts{Config: config})
+	if err == nil || !strings.Contains(err.Error(), "present in images lock") {
+		t.Fatalf("Expected offline resolution of unlocked image to fail, but was: %v", err)
+	}
+}
+
+func TestNewConfigFromYAMLErrors(t *testing.T) {
+	cases := map[string]string{
+		"unknown kind":      "apiVersion: kbld.k14s.io/v1alpha1\nkind: Other\n",
+		"wrong api version": "apiVersion: v1\nkind: Config\n",
+		"missing newImage":  "apiVersion: kbld.k14s.io/v1alpha1\nkind: Config\noverrides:\n- image: app\n",
+		"non-string key":    "apiVersion: kbld.k14s.io/v1alpha1\nkind: Config\noverrides:\n- image: app\n  newImage: app:1.0\n  true: false\n",
+	}
+
+	for desc, yaml := range cases {
+		_, err := NewConfigFromYAML([]byte(yaml))
+		if err == nil {
+			t.Fatalf("Expected config with %s to fail", desc)
+		}
+	}
+}
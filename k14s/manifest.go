@@ -0,0 +1,202 @@
+package k14s
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/hashcode"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/k14s/ytt/pkg/yamlmeta"
+)
+
+// manifestDocument is a single Kubernetes resource from the manifest list
+type manifestDocument struct {
+	Group     string
+	Kind      string
+	Namespace string
+	Name      string
+	Object    map[string]interface{}
+}
+
+func newManifestDocument(doc string) (manifestDocument, error) {
+	objs, err := manifestObjects(doc)
+	if err != nil {
+		return manifestDocument{}, err
+	}
+
+	if len(objs) != 1 {
+		return manifestDocument{}, fmt.Errorf("Expected manifest entry to contain exactly one document, but found %d", len(objs))
+	}
+
+	obj := objs[0]
+	metadata, _ := obj["metadata"].(map[string]interface{})
+
+	result := manifestDocument{Object: obj}
+	result.Kind, _ = obj["kind"].(string)
+
+	apiVersion, _ := obj["apiVersion"].(string)
+	if pieces := strings.SplitN(apiVersion, "/", 2); len(pieces) == 2 {
+		result.Group = pieces[0]
+	}
+
+	result.Name, _ = metadata["name"].(string)
+	result.Namespace, _ = metadata["namespace"].(string)
+
+	if result.Kind == "" || result.Name == "" {
+		return manifestDocument{}, fmt.Errorf("Expected manifest document to specify kind and metadata.name")
+	}
+
+	return result, nil
+}
+
+// manifestObjects parses non-empty documents, normalised with
+// manifestNormalizeValue
+func manifestObjects(yaml string) ([]map[string]interface{}, error) {
+	docSet, err := yamlmeta.NewDocumentSetFromBytes([]byte(yaml), yamlmeta.DocSetOpts{WithoutMeta: true})
+	if err != nil {
+		return nil, fmt.Errorf("Parsing manifest document: %s", err)
+	}
+
+	var objs []map[string]interface{}
+
+	for _, item := range docSet.Items {
+		if item.IsEmpty() {
+			continue
+		}
+
+		obj, ok := yttUnorderedValue(item.AsInterface()).(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Expected manifest document to be a map")
+		}
+
+		objs = append(objs, manifestNormalizeValue(obj).(map[string]interface{}))
+	}
+
+	return objs, nil
+}
+
+// Key identifies the resource regardless of API version (e.g.
+// Deployment.apps/default/web); documents without a namespace are
+// deployed into the app namespace
+func (d manifestDocument) Key(defaultNamespace string) string {
+	namespace := d.Namespace
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+
+	kind := d.Kind
+	if d.Group != "" {
+		kind += "." + d.Group
+	}
+
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, d.Name)
+}
+
+func (d manifestDocument) YAML() (string, error) {
+	docBytes, err := yamlmeta.PlainMarshal(d.Object)
+	if err != nil {
+		return "", fmt.Errorf("Marshaling manifest document: %s", err)
+	}
+	return string(docBytes), nil
+}
+
+// manifestNormalizeValue drops fields that do not affect the deployed
+// resource: null values (e.g. creationTimestamp: null from generated
+// manifests) and status. Keys are sorted when marshaled.
+func manifestNormalizeValue(val interface{}) interface{} {
+	switch typedVal := val.(type) {
+	case map[string]interface{}:
+		result := map[string]interface{}{}
+		for key, item := range typedVal {
+			if item == nil {
+				continue
+			}
+			result[key] = manifestNormalizeValue(item)
+		}
+		return result
+
+	case []interface{}:
+		result := make([]interface{}, len(typedVal))
+		for i, item := range typedVal {
+			result[i] = manifestNormalizeValue(item)
+		}
+		return result
+
+	default:
+		return val
+	}
+}
+
+// manifestStateFunc stores documents in normalised form so that
+// formatting, key order, null values and status do not show up as
+// changes. Fields defaulted by the API server are not known here, so
+// they have to be left out of the configuration.
+func manifestStateFunc(val interface{}) string {
+	doc, err := newManifestDocument(val.(string))
+	if err != nil {
+		// Invalid documents are reported by manifestValidateFunc
+		return val.(string)
+	}
+
+	delete(doc.Object, "status")
+
+	docYAML, err := doc.YAML()
+	if err != nil {
+		return val.(string)
+	}
+
+	return docYAML
+}
+
+// manifestHash identifies manifest set entries by their normalised
+// document, so that entries are diffed per document rather than by
+// position. Hashing by resource instead would silently drop all but one
+// entry for the same resource before manifestYAML could reject them.
+func manifestHash(val interface{}) int {
+	return hashcode.String(manifestStateFunc(val))
+}
+
+// manifestList returns manifest entries ordered by resource
+func manifestList(d yttResourceGetter) []string {
+	return expandStringSlice(d.Get("manifest").(*schema.Set).List())
+}
+
+func manifestValidateFunc(val interface{}, key string) ([]string, []error) {
+	_, err := newManifestDocument(val.(string))
+	if err != nil {
+		return nil, []error{fmt.Errorf("%s: %s", key, err)}
+	}
+	return nil, nil
+}
+
+// manifestYAML joins manifest documents, checking that each resource is
+// only specified once
+func manifestYAML(docs []string, defaultNamespace string) (string, error) {
+	var result string
+
+	seenKeys := map[string]struct{}{}
+
+	for _, docParam := range docs {
+		doc, err := newManifestDocument(docParam)
+		if err != nil {
+			return "", err
+		}
+
+		key := doc.Key(defaultNamespace)
+		if _, found := seenKeys[key]; found {
+			return "", fmt.Errorf("Expected manifest resource '%s' to be specified once", key)
+		}
+		seenKeys[key] = struct{}{}
+
+		delete(doc.Object, "status")
+
+		docYAML, err := doc.YAML()
+		if err != nil {
+			return "", err
+		}
+
+		result += "---\n" + docYAML
+	}
+
+	return result, nil
+}
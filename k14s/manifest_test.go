@@ -0,0 +1,181 @@
+package k14s
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/terraform"
+)
+
+const (
+	manifestConfigMapA = `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a"},"data":{"key":"a"}}`
+	manifestConfigMapB = `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"b","namespace":"other"},"data":{"key":"b"}}`
+)
+
+// manifestTestResource only has the attributes manifest diffs depend on
+func manifestTestResource() *schema.Resource {
+	appSchema := resourceApp().Schema
+
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"manifest":   appSchema["manifest"],
+			"state_mode": appSchema["state_mode"],
+		},
+	}
+}
+
+func manifestTestState(docs ...string) *terraform.InstanceState {
+	attrs := map[string]string{
+		"id":         "test",
+		"state_mode": appStateModeFull,
+		"manifest.#": strconv.Itoa(len(docs)),
+	}
+
+	for _, doc := range docs {
+		attrs["manifest."+strconv.Itoa(manifestHash(doc))] = manifestStateFunc(doc)
+	}
+
+	return &terraform.InstanceState{ID: "test", Attributes: attrs}
+}
+
+func manifestTestDiff(t *testing.T, state *terraform.InstanceState, docs ...interface{}) *terraform.InstanceDiff {
+	t.Helper()
+
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{"manifest": docs})
+
+	diff, err := manifestTestResource().Diff(state, config, nil)
+	if err != nil {
+		t.Fatalf("Expected diff to succeed: %s", err)
+	}
+
+	return diff
+}
+
+func TestManifestDiffIgnoresOrderAndFormatting(t *testing.T) {
+	state := manifestTestState(manifestConfigMapA, manifestConfigMapB)
+
+	reformattedA := "kind: ConfigMap\napiVersion: v1\nmetadata:\n  name: a\n  creationTimestamp: null\ndata:\n  key: a\nstatus: {}\n"
+
+	diff := manifestTestDiff(t, state, manifestConfigMapB, reformattedA)
+	if diff != nil && !diff.Empty() {
+		t.Fatalf("Expected reordered and reformatted manifest to not change, but was: %#v", diff.Attributes)
+	}
+}
+
+func TestManifestDiffPerDocument(t *testing.T) {
+	state := manifestTestState(manifestConfigMapA, manifestConfigMapB)
+
+	changedB := strings.Replace(manifestConfigMapB, `"key":"b"`, `"key":"changed"`, 1)
+	newC := `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"c"}}`
+
+	// New entry first would shift every position of a list
+	diff := manifestTestDiff(t, state, newC, manifestConfigMapA, changedB)
+	if diff == nil {
+		t.Fatalf("Expected manifest changes")
+	}
+
+	codeA := "manifest." + strconv.Itoa(manifestHash(manifestConfigMapA))
+	codeB := "manifest." + strconv.Itoa(manifestHash(manifestConfigMapB))
+	codeChangedB := "manifest." + strconv.Itoa(manifestHash(changedB))
+	codeC := "manifest." + strconv.Itoa(manifestHash(newC))
+
+	// All set elements are listed when the count changes, unchanged ones keep their value
+	if attrA, found := diff.Attributes[codeA]; found && attrA.Old != attrA.New {
+		t.Fatalf("Expected unchanged entry to not be diffed, but was: %#v", attrA)
+	}
+
+	if attrB, found := diff.Attributes[codeB]; !found || !attrB.NewRemoved {
+		t.Fatalf("Expected previous entry to be removed, but was: %#v", diff.Attributes)
+	}
+
+	if attrB, found := diff.Attributes[codeChangedB]; !found || !strings.Contains(attrB.New, "changed") {
+		t.Fatalf("Expected changed entry to be added, but was: %#v", diff.Attributes)
+	}
+
+	if _, found := diff.Attributes[codeC]; !found {
+		t.Fatalf("Expected new entry to be added, but was: %#v", diff.Attributes)
+	}
+}
+
+func TestManifestHash(t *testing.T) {
+	reformatted := "kind: ConfigMap\napiVersion: v1\nmetadata:\n  name: a\ndata:\n  key: a\n"
+
+	if manifestHash(manifestConfigMapA) != manifestHash(reformatted) {
+		t.Fatalf("Expected reformatted entries to have the same hash")
+	}
+
+	// Entries for the same resource must stay distinct so duplicates can be rejected
+	otherData := strings.Replace(manifestConfigMapA, `"key":"a"`, `"key":"other"`, 1)
+
+	if manifestHash(manifestConfigMapA) == manifestHash(otherData) {
+		t.Fatalf("Expected entries with different content to have different hashes")
+	}
+}
+
+func TestManifestDocumentKey(t *testing.T) {
+	doc, err := newManifestDocument(`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web"}}`)
+	if err != nil {
+		t.Fatalf("Expected document to parse: %s", err)
+	}
+
+	if key := doc.Key("default"); key != "Deployment.apps/default/web" {
+		t.Fatalf("Expected key to include API group, but was: %s", key)
+	}
+
+	if key := doc.Key(""); key != "Deployment.apps//web" {
+		t.Fatalf("Expected key to have empty namespace, but was: %s", key)
+	}
+}
+
+func TestManifestDiffRejectsDuplicates(t *testing.T) {
+	otherData := strings.Replace(manifestConfigMapA, `"key":"a"`, `"key":"other"`, 1)
+
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"app":       "test",
+		"namespace": "default",
+		"manifest":  []interface{}{manifestConfigMapA, otherData},
+	})
+
+	_, err := resourceApp().Diff(nil, config, nil)
+	if err == nil || !strings.Contains(err.Error(), "ConfigMap/default/a") {
+		t.Fatalf("Expected resource specified twice to be rejected, but was: %v", err)
+	}
+}
+
+func TestManifestYAMLDuplicates(t *testing.T) {
+	explicitNamespace := `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a","namespace":"default"}}`
+
+	_, err := manifestYAML([]string{manifestConfigMapA, explicitNamespace}, "default")
+	if err == nil || !strings.Contains(err.Error(), "ConfigMap/default/a") {
+		t.Fatalf("Expected resource in default namespace to be detected as duplicate, but was: %v", err)
+	}
+
+	_, err = manifestYAML([]string{manifestConfigMapA, explicitNamespace}, "apps")
+	if err != nil {
+		t.Fatalf("Expected resources in different namespaces to be allowed: %s", err)
+	}
+
+	deploymentA := `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"a"}}`
+	extensionsDeploymentA := `{"apiVersion":"extensions/v1beta1","kind":"Deployment","metadata":{"name":"a"}}`
+	appsV1beta1DeploymentA := `{"apiVersion":"apps/v1beta1","kind":"Deployment","metadata":{"name":"a"}}`
+
+	_, err = manifestYAML([]string{deploymentA, extensionsDeploymentA}, "default")
+	if err != nil {
+		t.Fatalf("Expected resources in different API groups to be allowed: %s", err)
+	}
+
+	_, err = manifestYAML([]string{deploymentA, appsV1beta1DeploymentA}, "default")
+	if err == nil || !strings.Contains(err.Error(), "Deployment.apps/default/a") {
+		t.Fatalf("Expected resource in another version of the same API group to be detected as duplicate, but was: %v", err)
+	}
+}
+
+func TestManifestStateFuncNormalises(t *testing.T) {
+	normalised := manifestStateFunc("metadata:\n  name: a\n  creationTimestamp: null\nkind: ConfigMap\nstatus:\n  phase: x\n")
+
+	if normalised != "kind: ConfigMap\nmetadata:\n  name: a\n" {
+		t.Fatalf("Expected nulls and status to be dropped and keys sorted, but was: %q", normalised)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"log"
+	"strconv"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/terraform"
@@ -33,153 +35,227 @@ func Provider() terraform.ResourceProvider {
 							Optional:    true,
 							MinItems:    0,
 							MaxItems:    1,
-							Elem: &schema.Resource{
-								Schema: map[string]*schema.Schema{
-									"host": {
-										Type:        schema.TypeString,
-										Optional:    true,
-										DefaultFunc: schema.EnvDefaultFunc("KUBE_HOST", ""),
-										Description: "The hostname (in form of URI) of Kubernetes master.",
-									},
-									"username": {
-										Type:        schema.TypeString,
-										Optional:    true,
-										DefaultFunc: schema.EnvDefaultFunc("KUBE_USER", ""),
-										Description: "The username to use for HTTP basic authentication when accessing the Kubernetes master endpoint.",
-									},
-									"password": {
-										Type:        schema.TypeString,
-										Optional:    true,
-										DefaultFunc: schema.EnvDefaultFunc("KUBE_PASSWORD", ""),
-										Description: "The password to use for HTTP basic authentication when accessing the Kubernetes master endpoint.",
-									},
-									"insecure": {
-										Type:        schema.TypeBool,
-										Optional:    true,
-										DefaultFunc: schema.EnvDefaultFunc("KUBE_INSECURE", false),
-										Description: "Whether server should be accessed without verifying the TLS certificate.",
-									},
-									"client_certificate": {
-										Type:        schema.TypeString,
-										Optional:    true,
-										DefaultFunc: schema.EnvDefaultFunc("KUBE_CLIENT_CERT_DATA", ""),
-										Description: "PEM-encoded client certificate for TLS authentication.",
-									},
-									"client_key": {
-										Type:        schema.TypeString,
-										Optional:    true,
-										DefaultFunc: schema.EnvDefaultFunc("KUBE_CLIENT_KEY_DATA", ""),
-										Description: "PEM-encoded client certificate key for TLS authentication.",
-									},
-									"cluster_ca_certificate": {
-										Type:        schema.TypeString,
-										Optional:    true,
-										DefaultFunc: schema.EnvDefaultFunc("KUBE_CLUSTER_CA_CERT_DATA", ""),
-										Description: "PEM-encoded root certificates bundle for TLS authentication.",
-									},
-									"config_path": {
-										Type:     schema.TypeString,
-										Optional: true,
-										DefaultFunc: schema.MultiEnvDefaultFunc(
-											[]string{
-												"KUBE_CONFIG",
-												"KUBECONFIG",
-											},
-											"~/.kube/config"),
-										Description: "Path to the kube config file, defaults to ~/.kube/config",
-									},
-									"config_context": {
-										Type:        schema.TypeString,
-										Optional:    true,
-										DefaultFunc: schema.EnvDefaultFunc("KUBE_CTX", ""),
-									},
-									"config_context_auth_info": {
-										Type:        schema.TypeString,
-										Optional:    true,
-										DefaultFunc: schema.EnvDefaultFunc("KUBE_CTX_AUTH_INFO", ""),
-										Description: "",
-									},
-									"config_context_cluster": {
-										Type:        schema.TypeString,
-										Optional:    true,
-										DefaultFunc: schema.EnvDefaultFunc("KUBE_CTX_CLUSTER", ""),
-										Description: "",
-									},
-									"token": {
-										Type:        schema.TypeString,
-										Optional:    true,
-										DefaultFunc: schema.EnvDefaultFunc("KUBE_TOKEN", ""),
-										Description: "Token to authenticate an service account",
-									},
-									"load_config_file": {
-										Type:        schema.TypeBool,
-										Optional:    true,
-										DefaultFunc: schema.EnvDefaultFunc("KUBE_LOAD_CONFIG_FILE", true),
-										Description: "Load local kubeconfig.",
-									},
-									"exec": {
-										Type:     schema.TypeList,
-										Optional: true,
-										MaxItems: 1,
-										Elem: &schema.Resource{
-											Schema: map[string]*schema.Schema{
-												"api_version": {
-													Type:     schema.TypeString,
-													Required: true,
-												},
-												"command": {
-													Type:     schema.TypeString,
-													Required: true,
-												},
-												"env": {
-													Type:     schema.TypeMap,
-													Optional: true,
-													Elem:     &schema.Schema{Type: schema.TypeString},
-												},
-												"args": {
-													Type:     schema.TypeList,
-													Optional: true,
-													Elem:     &schema.Schema{Type: schema.TypeString},
-												},
-											},
-										},
-										Description: "",
-									},
-								},
-							},
+							Elem:        kubernetesResource(),
 						},
 					},
 				},
 			},
+			"http_timeout": {
+				Type:        schema.TypeString,
+				Description: "Timeout for downloading HTTP(S) files (e.g. 30s)",
+				Optional:    true,
+				Default:     defaultHTTPTimeout.String(),
+			},
+			"http_cache_dir": {
+				Type:        schema.TypeString,
+				Description: "Directory used to cache downloaded HTTP(S) files, defaults to the user cache directory. Only URLs pinned with a #sha256=<hex> suffix are served from the cache, others are downloaded on every read",
+				Optional:    true,
+			},
 		},
 
 		ResourcesMap: map[string]*schema.Resource{
-			"k14sx_kapp": resourceApp(),
+			"k14sx_kapp":                resourceApp(),
+			"k14sx_ytt_template":        resourceYttTemplate(),
+			"k14sx_kapp_controller_app": resourceKappControllerApp(),
 		},
 
 		DataSourcesMap: map[string]*schema.Resource{
-			"k14sx_ytt": datasourceYtt(),
+			"k14sx_ytt":       datasourceYtt(),
+			"k14sx_kbld":      datasourceKbld(),
+			"k14sx_vendir":    datasourceVendir(),
+			"k14sx_kapp_diff": datasourceKappDiff(),
 		},
 
 		ConfigureFunc: providerConfigure,
 	}
 }
 
+func kubernetesResource() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"host": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("KUBE_HOST", ""),
+				Description: "The hostname (in form of URI) of Kubernetes master.",
+			},
+			"username": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("KUBE_USER", ""),
+				Description: "The username to use for HTTP basic authentication when accessing the Kubernetes master endpoint.",
+			},
+			"password": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("KUBE_PASSWORD", ""),
+				Description: "The password to use for HTTP basic authentication when accessing the Kubernetes master endpoint.",
+			},
+			"insecure": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("KUBE_INSECURE", false),
+				Description: "Whether server should be accessed without verifying the TLS certificate.",
+			},
+			"client_certificate": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("KUBE_CLIENT_CERT_DATA", ""),
+				Description: "PEM-encoded client certificate for TLS authentication.",
+			},
+			"client_key": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("KUBE_CLIENT_KEY_DATA", ""),
+				Description: "PEM-encoded client certificate key for TLS authentication.",
+			},
+			"cluster_ca_certificate": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("KUBE_CLUSTER_CA_CERT_DATA", ""),
+				Description: "PEM-encoded root certificates bundle for TLS authentication.",
+			},
+			"config_path": {
+				Type:     schema.TypeString,
+				Optional: true,
+				DefaultFunc: schema.MultiEnvDefaultFunc(
+					[]string{
+						"KUBE_CONFIG",
+						"KUBECONFIG",
+					},
+					"~/.kube/config"),
+				Description: "Path to the kube config file, defaults to ~/.kube/config",
+			},
+			"config_context": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("KUBE_CTX", ""),
+			},
+			"config_context_auth_info": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("KUBE_CTX_AUTH_INFO", ""),
+				Description: "",
+			},
+			"config_context_cluster": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("KUBE_CTX_CLUSTER", ""),
+				Description: "",
+			},
+			"token": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("KUBE_TOKEN", ""),
+				Description: "Token to authenticate an service account",
+			},
+			"load_config_file": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("KUBE_LOAD_CONFIG_FILE", true),
+				Description: "Load local kubeconfig.",
+			},
+			"qps": {
+				Type:        schema.TypeFloat,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("KUBE_QPS", nil),
+				Description: "Maximum queries per second to the Kubernetes API server. Unset or 0 uses the client-go default (5), a negative value disables client-side rate limiting.",
+			},
+			"burst": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("KUBE_BURST", nil),
+				Description: "Maximum burst of requests to the Kubernetes API server. Unset or 0 uses the client-go default (10).",
+			},
+			"timeout": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("KUBE_TIMEOUT", ""),
+				Description: "Timeout for a single request to the Kubernetes API server (e.g. 30s), defaults to no timeout.",
+			},
+			"exec": {
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"api_version": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"command": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"env": {
+							Type:     schema.TypeMap,
+							Optional: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+						},
+						"args": {
+							Type:     schema.TypeList,
+							Optional: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+						},
+					},
+				},
+				Description: "",
+			},
+		},
+	}
+}
+
 func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 	clientConfig, err := initializeConfiguration(d)
 	if err != nil {
 		return nil, err
 	}
 
-	depsFactory := util.NewDepsFactoryImpl(clientConfig)
+	depsFactoryOpts, err := initializeClientOpts(d)
+	if err != nil {
+		return nil, err
+	}
+
+	depsFactory := util.NewDepsFactoryImpl(clientConfig, depsFactoryOpts)
+
+	httpTimeout, err := time.ParseDuration(d.Get("http_timeout").(string))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse http_timeout: %s", err)
+	}
+
+	httpCacheDir := d.Get("http_cache_dir").(string)
+	if httpCacheDir == "" {
+		httpCacheDir = util.DefaultHTTPCacheDir()
+	}
 
 	config := &Config{
 		DepsFactory: depsFactory,
+		HTTPFetcher: util.NewHTTPFetcher(httpTimeout, httpCacheDir),
 	}
 
 	return config, nil
 }
 
+func initializeClientOpts(d *schema.ResourceData) (util.DepsFactoryOpts, error) {
+	opts := util.DepsFactoryOpts{}
+
+	if v, ok := k8sGetOk(d, "qps"); ok {
+		opts.QPS = float32(v.(float64))
+	}
+	if v, ok := k8sGetOk(d, "burst"); ok {
+		opts.Burst = v.(int)
+	}
+	if v, ok := k8sGetOk(d, "timeout"); ok {
+		timeout, err := time.ParseDuration(v.(string))
+		if err != nil {
+			return opts, fmt.Errorf("Failed to parse timeout: %s", err)
+		}
+		opts.Timeout = timeout
+	}
+
+	return opts, nil
+}
+
 // Copied this from kubernetes provider implementation
 func initializeConfiguration(d *schema.ResourceData) (*restclient.Config, error) {
 	overrides := &clientcmd.ConfigOverrides{}
@@ -304,29 +380,69 @@ var k8sPrefix = "kapp.0.kubernetes.0."
 func k8sGetOk(d *schema.ResourceData, key string) (interface{}, bool) {
 	value, ok := d.GetOk(k8sPrefix + key)
 
-	// For boolean attributes the zero value is Ok
+	// For boolean and numeric attributes the zero value is Ok
 	switch value.(type) {
-	case bool:
+	case bool, int, float64:
 		value, ok = d.GetOkExists(k8sPrefix + key)
 	}
 
-	// removed for now
-	// fix: DefaultFunc is not being triggerred on TypeList
-	/*schema := kubernetesResource().Schema[key]
-	if !ok && schema.DefaultFunc != nil {
-		value, _ = schema.DefaultFunc()
-
-		switch v := value.(type) {
-		case string:
-			ok = len(v) != 0
-		case bool:
-			ok = v
-		}
-	}*/
+	// DefaultFunc is not triggered for attributes nested in a TypeList
+	// when the block itself is omitted, so fall back to it explicitly
+	if !ok {
+		return k8sDefault(key)
+	}
 
 	return value, ok
 }
 
+func k8sDefault(key string) (interface{}, bool) {
+	s, found := kubernetesResource().Schema[key]
+	if !found || s.DefaultFunc == nil {
+		return nil, false
+	}
+
+	value, err := s.DefaultFunc()
+	if err != nil || value == nil {
+		return nil, false
+	}
+
+	switch s.Type {
+	case schema.TypeBool:
+		// EnvDefaultFunc returns the raw environment string
+		if str, isStr := value.(string); isStr {
+			b, err := strconv.ParseBool(str)
+			if err != nil {
+				log.Printf("[WARN] Ignoring invalid boolean default for %s: %q", key, str)
+				return false, false
+			}
+			value = b
+		}
+		return value, value.(bool)
+	case schema.TypeInt:
+		if str, isStr := value.(string); isStr {
+			i, err := strconv.Atoi(str)
+			if err != nil {
+				log.Printf("[WARN] Ignoring invalid integer default for %s: %q", key, str)
+				return 0, false
+			}
+			value = i
+		}
+	case schema.TypeFloat:
+		if str, isStr := value.(string); isStr {
+			f, err := strconv.ParseFloat(str, 64)
+			if err != nil {
+				log.Printf("[WARN] Ignoring invalid float default for %s: %q", key, str)
+				return 0.0, false
+			}
+			value = f
+		}
+	case schema.TypeString:
+		return value, value.(string) != ""
+	}
+
+	return value, true
+}
+
 func k8sGet(d *schema.ResourceData, key string) interface{} {
 	value, _ := k8sGetOk(d, key)
 	return value
@@ -0,0 +1,262 @@
+package k14s
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+// k8sEnvVars are all environment variables read by kubernetesResource defaults
+var k8sEnvVars = []string{
+	"KUBE_HOST", "KUBE_USER", "KUBE_PASSWORD", "KUBE_INSECURE", "KUBE_CLIENT_CERT_DATA",
+	"KUBE_CLIENT_KEY_DATA", "KUBE_CLUSTER_CA_CERT_DATA", "KUBE_CONFIG", "KUBECONFIG",
+	"KUBE_CTX", "KUBE_CTX_AUTH_INFO", "KUBE_CTX_CLUSTER", "KUBE_TOKEN",
+	"KUBE_LOAD_CONFIG_FILE", "KUBE_QPS", "KUBE_BURST", "KUBE_TIMEOUT",
+}
+
+// setK8sEnv replaces all kubernetes env vars with env and returns a
+// function restoring the previous environment
+func setK8sEnv(env map[string]string) func() {
+	prevEnv := map[string]string{}
+
+	for _, key := range k8sEnvVars {
+		if val, found := os.LookupEnv(key); found {
+			prevEnv[key] = val
+		}
+		os.Unsetenv(key)
+	}
+
+	for key, val := range env {
+		os.Setenv(key, val)
+	}
+
+	return func() {
+		for _, key := range k8sEnvVars {
+			os.Unsetenv(key)
+		}
+		for key, val := range prevEnv {
+			os.Setenv(key, val)
+		}
+	}
+}
+
+// k8sResourceData builds provider configuration, kubernetes is nil when
+// the kubernetes block is omitted
+func k8sResourceData(t *testing.T, kubernetes map[string]interface{}) *schema.ResourceData {
+	raw := map[string]interface{}{}
+
+	if kubernetes != nil {
+		raw["kapp"] = []interface{}{
+			map[string]interface{}{
+				"kubernetes": []interface{}{kubernetes},
+			},
+		}
+	}
+
+	return schema.TestResourceDataRaw(t, Provider().(*schema.Provider).Schema, raw)
+}
+
+type k8sAttrCase struct {
+	key         string
+	envVar      string
+	configValue interface{}
+	envValue    string
+	envResult   interface{}
+	// defaultResult is returned (with defaultOk) when neither config nor env is set
+	defaultResult interface{}
+	defaultOk     bool
+}
+
+var k8sAttrCases = []k8sAttrCase{
+	{"host", "KUBE_HOST", "https://config", "https://env", "https://env", "", false},
+	{"username", "KUBE_USER", "config-user", "env-user", "env-user", "", false},
+	{"password", "KUBE_PASSWORD", "config-pass", "env-pass", "env-pass", "", false},
+	{"insecure", "KUBE_INSECURE", true, "true", true, false, false},
+	{"client_certificate", "KUBE_CLIENT_CERT_DATA", "config-cert", "env-cert", "env-cert", "", false},
+	{"client_key", "KUBE_CLIENT_KEY_DATA", "config-key", "env-key", "env-key", "", false},
+	{"cluster_ca_certificate", "KUBE_CLUSTER_CA_CERT_DATA", "config-ca", "env-ca", "env-ca", "", false},
+	{"config_path", "KUBE_CONFIG", "/config/kubeconfig", "/env/kubeconfig", "/env/kubeconfig", "~/.kube/config", true},
+	{"config_path", "KUBECONFIG", "/config/kubeconfig", "/env/kubeconfig", "/env/kubeconfig", "~/.kube/config", true},
+	{"config_context", "KUBE_CTX", "config-ctx", "env-ctx", "env-ctx", "", false},
+	{"config_context_auth_info", "KUBE_CTX_AUTH_INFO", "config-auth", "env-auth", "env-auth", "", false},
+	{"config_context_cluster", "KUBE_CTX_CLUSTER", "config-cluster", "env-cluster", "env-cluster", "", false},
+	{"token", "KUBE_TOKEN", "config-token", "env-token", "env-token", "", false},
+	{"load_config_file", "KUBE_LOAD_CONFIG_FILE", false, "false", false, true, true},
+	{"qps", "KUBE_QPS", 5.5, "20.5", 20.5, nil, false},
+	{"burst", "KUBE_BURST", 5, "20", 20, nil, false},
+	{"timeout", "KUBE_TIMEOUT", "10s", "20s", "20s", "", false},
+}
+
+func TestK8sGetOkPrecedence(t *testing.T) {
+	for _, tc := range k8sAttrCases {
+		type check struct {
+			desc       string
+			kubernetes map[string]interface{}
+			env        map[string]string
+			expected   interface{}
+			expectedOk bool
+		}
+
+		checks := []check{
+			{
+				desc:       "config over env",
+				kubernetes: map[string]interface{}{tc.key: tc.configValue},
+				env:        map[string]string{tc.envVar: tc.envValue},
+				expected:   tc.configValue,
+				expectedOk: true,
+			},
+			{
+				desc:       "env with block omitted",
+				env:        map[string]string{tc.envVar: tc.envValue},
+				expected:   tc.envResult,
+				expectedOk: true,
+			},
+			{
+				desc:       "env with block present",
+				kubernetes: map[string]interface{}{},
+				env:        map[string]string{tc.envVar: tc.envValue},
+				expected:   tc.envResult,
+				expectedOk: true,
+			},
+			{
+				desc:       "default with block omitted",
+				expected:   tc.defaultResult,
+				expectedOk: tc.defaultOk,
+			},
+			{
+				desc:       "default with block present",
+				kubernetes: map[string]interface{}{},
+				expected:   tc.defaultResult,
+				expectedOk: tc.defaultOk,
+			},
+		}
+
+		if b, isBool := tc.envResult.(bool); isBool && !b {
+			// Without the block false env values are unset (same as GetOk)
+			checks[1].expectedOk = false
+		}
+		if _, isBool := tc.defaultResult.(bool); isBool {
+			// With the block the SDK applies defaults, which are
+			// indistinguishable from configured booleans
+			checks[2].expectedOk = true
+			checks[4].expectedOk = true
+		}
+
+		for _, c := range checks {
+			restoreEnv := setK8sEnv(c.env)
+			d := k8sResourceData(t, c.kubernetes)
+
+			value, ok := k8sGetOk(d, tc.key)
+
+			restoreEnv()
+
+			if value != c.expected || ok != c.expectedOk {
+				t.Fatalf("%s (%s): %s: expected (%#v, %t), but was (%#v, %t)",
+					tc.key, tc.envVar, c.desc, c.expected, c.expectedOk, value, ok)
+			}
+		}
+	}
+}
+
+func TestK8sGetOkExplicitFalse(t *testing.T) {
+	restoreEnv := setK8sEnv(map[string]string{"KUBE_INSECURE": "true", "KUBE_LOAD_CONFIG_FILE": "true"})
+	defer restoreEnv()
+
+	d := k8sResourceData(t, map[string]interface{}{
+		"insecure":         false,
+		"load_config_file": false,
+	})
+
+	for _, key := range []string{"insecure", "load_config_file"} {
+		value, ok := k8sGetOk(d, key)
+		if value != false || !ok {
+			t.Fatalf("Expected explicit false %s to override env, but was (%#v, %t)", key, value, ok)
+		}
+	}
+}
+
+func TestK8sGetOkExplicitZero(t *testing.T) {
+	restoreEnv := setK8sEnv(map[string]string{"KUBE_QPS": "20", "KUBE_BURST": "40"})
+	defer restoreEnv()
+
+	d := k8sResourceData(t, map[string]interface{}{"qps": 0.0, "burst": 0})
+
+	opts, err := initializeClientOpts(d)
+	if err != nil {
+		t.Fatalf("Expected client opts to be initialized: %s", err)
+	}
+
+	if opts.QPS != 0 || opts.Burst != 0 {
+		t.Fatalf("Expected explicit zero to override env, but was qps %v and burst %d", opts.QPS, opts.Burst)
+	}
+
+	d = k8sResourceData(t, nil)
+
+	opts, err = initializeClientOpts(d)
+	if err != nil {
+		t.Fatalf("Expected client opts to be initialized: %s", err)
+	}
+
+	if opts.QPS != 20 || opts.Burst != 40 {
+		t.Fatalf("Expected env to be used, but was qps %v and burst %d", opts.QPS, opts.Burst)
+	}
+}
+
+func TestK8sDefaultInvalidEnv(t *testing.T) {
+	cases := []struct {
+		key    string
+		envVar string
+		value  string
+	}{
+		{"insecure", "KUBE_INSECURE", "yes please"},
+		{"load_config_file", "KUBE_LOAD_CONFIG_FILE", "maybe"},
+		{"burst", "KUBE_BURST", "1.5"},
+		{"burst", "KUBE_BURST", "lots"},
+		{"qps", "KUBE_QPS", "fast"},
+	}
+
+	for _, tc := range cases {
+		restoreEnv := setK8sEnv(map[string]string{tc.envVar: tc.value})
+
+		value, ok := k8sDefault(tc.key)
+
+		restoreEnv()
+
+		if ok {
+			t.Fatalf("Expected invalid %s=%q to be ignored, but was %#v", tc.envVar, tc.value, value)
+		}
+	}
+}
+
+func TestK8sDefaultParsing(t *testing.T) {
+	cases := []struct {
+		key      string
+		envVar   string
+		value    string
+		expected interface{}
+	}{
+		{"insecure", "KUBE_INSECURE", "1", true},
+		{"insecure", "KUBE_INSECURE", "TRUE", true},
+		{"load_config_file", "KUBE_LOAD_CONFIG_FILE", "0", false},
+		{"burst", "KUBE_BURST", "42", 42},
+		{"qps", "KUBE_QPS", "2", 2.0},
+		{"host", "KUBE_HOST", "https://example.com", "https://example.com"},
+	}
+
+	for _, tc := range cases {
+		restoreEnv := setK8sEnv(map[string]string{tc.envVar: tc.value})
+
+		value, _ := k8sDefault(tc.key)
+
+		restoreEnv()
+
+		if value != tc.expected {
+			t.Fatalf("Expected %s=%q to parse as %#v, but was %#v", tc.envVar, tc.value, tc.expected, value)
+		}
+	}
+
+	if _, ok := k8sDefault("unknown"); ok {
+		t.Fatalf("Expected unknown attribute to have no default")
+	}
+}
@@ -1,11 +1,14 @@
 package k14s
 
 import (
+	"fmt"
 	"log"
+	"strings"
 
 	"github.com/cppforlife/go-cli-ui/ui"
 	"github.com/google/uuid"
 	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/validation"
 	"github.com/k14s/kapp/pkg/kapp/cmd/app"
 	cmdcore "github.com/k14s/kapp/pkg/kapp/cmd/core"
 	ctlres "github.com/k14s/kapp/pkg/kapp/resources"
@@ -13,40 +16,99 @@ import (
 	util "github.com/niallthomson/terraform-provider-k14s/k14s/util"
 )
 
+// appDeployKeys are arguments (and computed values planned from them)
+// that require a deploy when changed
+var appDeployKeys = []string{
+	"namespace", "config_yaml", "files", "manifest", "ytt", "ytt_input_hash", "state_mode", "resources_hash", "resources_yaml",
+}
+
 func resourceApp() *schema.Resource {
-	return &schema.Resource{
-		Schema: map[string]*schema.Schema{
-			"app": {
-				Type:        schema.TypeString,
-				Description: "The name of the app",
-				Required:    true,
-				ForceNew:    true,
-			},
-			"namespace": {
-				Type:        schema.TypeString,
-				Description: "The default namespace to operate in",
-				Required:    true,
-				ForceNew:    true,
+	s := map[string]*schema.Schema{
+		"app": {
+			Type:        schema.TypeString,
+			Description: "The name of the app. Changing it renames the app record in place, resources are not recreated",
+			Required:    true,
+		},
+		"namespace": {
+			Type:        schema.TypeString,
+			Description: "The default namespace to operate in, which also holds the app record. Changing it moves the app record, which is refused while resources without a namespace would be redeployed into the new namespace",
+			Required:    true,
+		},
+		"config_yaml": {
+			Type:             schema.TypeString,
+			Description:      "The config yaml to deploy",
+			Optional:         true,
+			DiffSuppressFunc: resourceAppHashedDiffSuppress,
+		},
+		"files": {
+			Type:        schema.TypeList,
+			Description: "The yaml files to deploy, HTTP(S) URLs may be pinned with a #sha256=<hex> suffix",
+			Optional:    true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
 			},
-			"config_yaml": {
-				Type:        schema.TypeString,
-				Description: "The config yaml to deploy",
-				Optional:    true,
+		},
+		"manifest": {
+			Type:             schema.TypeSet,
+			Description:      "Resources to deploy, one YAML or JSON document per entry (e.g. jsonencode() of an HCL object). Each resource (API group, kind, namespace and name) may only be specified once and the order of entries does not matter. Documents are normalised, so key order, formatting, null fields and status do not cause changes",
+			Optional:         true,
+			Set:              manifestHash,
+			DiffSuppressFunc: resourceAppHashedDiffSuppress,
+			Elem: &schema.Schema{
+				Type:         schema.TypeString,
+				StateFunc:    manifestStateFunc,
+				ValidateFunc: manifestValidateFunc,
 			},
-			"files": {
-				Type:        schema.TypeList,
-				Description: "The yaml files to deploy",
-				Optional:    true,
-				Elem: &schema.Schema{
-					Type: schema.TypeString,
-				},
+		},
+		"delete_policy": {
+			Type:        schema.TypeString,
+			Description: "What destroy does: delete (delete resources and the app record), orphan (delete the app record and remove kapp ownership labels so that another app can adopt the resources; refused for resources with label selectors or pod templates scoped by kapp, since selectors such as a Deployment's cannot be changed) or keep_app_record (leave the app and its resources in the cluster)",
+			Optional:    true,
+			Default:     string(kapp.DeletePolicyDelete),
+			ValidateFunc: validation.StringInSlice([]string{
+				string(kapp.DeletePolicyDelete), string(kapp.DeletePolicyOrphan), string(kapp.DeletePolicyKeepAppRecord),
+			}, false),
+		},
+		"state_mode": {
+			Type:         schema.TypeString,
+			Description:  "What is kept in state for config_yaml and manifest: full, or hashed (only resources_hash and redacted resources; changes are found by comparing hashes and kapp's last applied annotations in the cluster)",
+			Optional:     true,
+			Default:      appStateModeFull,
+			ValidateFunc: validation.StringInSlice([]string{appStateModeFull, appStateModeHashed}, false),
+		},
+		"ytt": {
+			Type:        schema.TypeList,
+			Description: "Render configuration with ytt during deploy (same inputs as k14sx_ytt). Rendered output is deployed along with config_yaml and files but not stored in state",
+			Optional:    true,
+			MaxItems:    1,
+			Elem: &schema.Resource{
+				Schema: yttInputSchema("output_format", "sensitive_kinds", "sensitive_match"),
 			},
 		},
-		Create: resourceAppCreate,
-		Read:   resourceAppRead,
-		Update: resourceAppUpdate,
-		Delete: resourceAppDelete,
-		Exists: resourceAppExists,
+		"ytt_input_hash": {
+			Type:        schema.TypeString,
+			Description: "Hash of ytt inputs used for the last deploy",
+			Computed:    true,
+		},
+		"ytt_summary": {
+			Type:        schema.TypeString,
+			Description: "Summary of documents rendered by ytt for the last deploy",
+			Computed:    true,
+		},
+	}
+
+	for key, keySchema := range appStateSchema() {
+		s[key] = keySchema
+	}
+
+	return &schema.Resource{
+		Schema:        s,
+		CustomizeDiff: resourceAppCustomizeDiff,
+		Create:        resourceAppCreate,
+		Read:          resourceAppRead,
+		Update:        resourceAppUpdate,
+		Delete:        resourceAppDelete,
+		Exists:        resourceAppExists,
 	}
 }
 
@@ -64,6 +126,46 @@ func resourceAppCreate(d *schema.ResourceData, meta interface{}) error {
 }
 
 func resourceAppUpdate(d *schema.ResourceData, meta interface{}) error {
+	renamed := true
+
+	if d.HasChange("app") || d.HasChange("namespace") {
+		c := meta.(*Config)
+
+		oldName, newName := d.GetChange("app")
+		oldNamespace, newNamespace := d.GetChange("namespace")
+
+		// Inputs may not have been known during plan
+		if d.HasChange("namespace") {
+			yttResult, err := resourceAppRenderYtt(d, meta)
+			if err != nil {
+				return err
+			}
+
+			err = resourceAppCheckNamespaceChange(resourceAppDeployInputs(d), meta, yttResult, oldNamespace.(string), newNamespace.(string))
+			if err != nil {
+				return err
+			}
+		}
+
+		var err error
+
+		renamed, err = kapp.NewRenameRequest(c.DepsFactory, oldName.(string), oldNamespace.(string),
+			newName.(string), newNamespace.(string)).Execute()
+		if err != nil {
+			return fmt.Errorf("Renaming app: %s", err)
+		}
+
+		if !renamed {
+			log.Printf("[INFO] App '%s' (namespace: %s) does not exist, deploying it as '%s' (namespace: %s)",
+				oldName, oldNamespace, newName, newNamespace)
+		}
+	}
+
+	// e.g. delete_policy only affects destroy
+	if renamed && !d.HasChanges(appDeployKeys...) {
+		return nil
+	}
+
 	return resourceAppDeploy(d, meta)
 }
 
@@ -72,6 +174,47 @@ func resourceAppDeploy(d *schema.ResourceData, meta interface{}) error {
 
 	name := d.Get("app").(string)
 	namespace := d.Get("namespace").(string)
+
+	yaml, files, yttResult, err := resourceAppInputs(resourceAppDeployInputs(d), meta)
+	if err != nil {
+		return err
+	}
+
+	err = kapp.NewDeployRequest(c.DepsFactory, name, namespace, yaml, files).Execute()
+	if err != nil {
+		return err
+	}
+
+	if yttResult != nil {
+		d.Set("ytt_input_hash", yttResult.InputHash)
+		d.Set("ytt_summary", yttResult.Summary)
+	} else {
+		d.Set("ytt_input_hash", "")
+		d.Set("ytt_summary", "")
+	}
+
+	return resourceAppSetStateAfterDeploy(d, meta)
+}
+
+// resourceAppInputs combines config_yaml, manifest and ytt output into one
+// yaml and fetches HTTP(S) files, so that the same resources are used for
+// deploy and k14sx_kapp_diff
+func resourceAppInputs(d yttResourceGetter, meta interface{}) (string, []string, *yttRenderResult, error) {
+	yttResult, err := resourceAppRenderYtt(d, meta)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	yaml, files, err := resourceAppCombineInputs(d, meta, yttResult)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	return yaml, files, yttResult, nil
+}
+
+// resourceAppCombineInputs is resourceAppInputs with ytt already rendered
+func resourceAppCombineInputs(d yttResourceGetter, meta interface{}, yttResult *yttRenderResult) (string, []string, error) {
 	yaml := d.Get("config_yaml").(string)
 
 	var files []string
@@ -79,15 +222,164 @@ func resourceAppDeploy(d *schema.ResourceData, meta interface{}) error {
 	filesParam := d.Get("files").([]interface{})
 	if len(filesParam) > 0 {
 		for _, fileParam := range filesParam {
-			files = append(files, fileParam.(string))
+			file := fileParam.(string)
+
+			if util.IsHTTPSource(file) {
+				localFile, err := httpFetcher(meta).Fetch(file)
+				if err != nil {
+					return "", nil, err
+				}
+				file = localFile
+			}
+
+			files = append(files, file)
 		}
 	}
 
-	err := kapp.NewDeployRequest(c.DepsFactory, name, namespace, yaml, files).Execute()
+	manifest, err := manifestYAML(manifestList(d), d.Get("namespace").(string))
+	if err != nil {
+		return "", nil, err
+	}
+
+	if manifest != "" {
+		if yaml != "" {
+			yaml += "\n"
+		}
+		yaml += manifest
+	}
+
+	if yttResult != nil {
+		if yaml != "" {
+			yaml += "\n---\n"
+		}
+		yaml += yttResult.Attributes["result"].(string)
+	}
+
+	return yaml, files, nil
+}
+
+// resourceAppRenderYtt returns nil when the ytt block is not set
+func resourceAppRenderYtt(d yttResourceGetter, meta interface{}) (*yttRenderResult, error) {
+	yttParams := d.Get("ytt").([]interface{})
+	if len(yttParams) == 0 {
+		return nil, nil
+	}
+
+	yttBlock, _ := yttParams[0].(map[string]interface{})
+
+	result, err := yttRender(yttBlockGetter(yttBlock), httpFetcher(meta))
+	if err != nil {
+		return nil, fmt.Errorf("Rendering ytt: %s", err)
+	}
+
+	return result, nil
+}
+
+// resourceAppCustomizeDiff checks manifest resources are unique and renders
+// ytt during plan so that changes to template files outside of the
+// configuration trigger a deploy
+func resourceAppCustomizeDiff(d *schema.ResourceDiff, meta interface{}) error {
+	if d.NewValueKnown("manifest") && d.NewValueKnown("namespace") {
+		_, err := manifestYAML(manifestList(d), d.Get("namespace").(string))
+		if err != nil {
+			return err
+		}
+	}
+
+	yttResult, err := resourceAppCustomizeDiffYtt(d, meta)
+	if err != nil {
+		return err
+	}
+
+	if d.Id() != "" && d.HasChange("namespace") && resourceAppInputsKnown(d) {
+		oldNamespace, newNamespace := d.GetChange("namespace")
+
+		err := resourceAppCheckNamespaceChange(d, meta, yttResult, oldNamespace.(string), newNamespace.(string))
+		if err != nil {
+			return err
+		}
+	}
+
+	return resourceAppCustomizeDiffState(d)
+}
+
+// resourceAppInputsKnown expects ytt_input_hash to be planned already
+func resourceAppInputsKnown(d *schema.ResourceDiff) bool {
+	for _, key := range []string{"namespace", "config_yaml", "files", "manifest", "ytt_input_hash"} {
+		if !d.NewValueKnown(key) {
+			return false
+		}
+	}
+	return true
+}
+
+// resourceAppCheckNamespaceChange prevents moving the app record when kapp
+// would deploy resources without a namespace into the new namespace, since
+// that deletes them from the old namespace
+func resourceAppCheckNamespaceChange(d yttResourceGetter, meta interface{}, yttResult *yttRenderResult, oldNamespace, newNamespace string) error {
+	c := meta.(*Config)
+
+	yaml, files, err := resourceAppCombineInputs(d, meta, yttResult)
 	if err != nil {
 		return err
 	}
 
+	descs, err := kapp.NewDefaultNamespaceRequest(c.DepsFactory, yaml, files).Execute()
+	if err != nil {
+		return fmt.Errorf("Checking resources without a namespace: %s", err)
+	}
+
+	if len(descs) > 0 {
+		return fmt.Errorf("Changing namespace from '%s' to '%s' would redeploy resources without a namespace "+
+			"into '%s': %s. Set their namespace explicitly before changing the app namespace",
+			oldNamespace, newNamespace, newNamespace, strings.Join(descs, ", "))
+	}
+
+	return nil
+}
+
+// resourceAppCustomizeDiffYtt plans ytt_input_hash and ytt_summary and
+// returns the ytt result, which is nil when ytt inputs are not known yet
+func resourceAppCustomizeDiffYtt(d *schema.ResourceDiff, meta interface{}) (*yttRenderResult, error) {
+	for key := range yttInputSchema("output_format", "sensitive_kinds", "sensitive_match") {
+		if !d.NewValueKnown("ytt.0." + key) {
+			log.Printf("[DEBUG] ytt input %s is not known yet, deferring ytt rendering to apply", key)
+			return nil, resourceAppSetYttNewComputed(d)
+		}
+	}
+
+	result, err := resourceAppRenderYtt(d, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	inputHash := ""
+	summary := ""
+
+	if result != nil {
+		inputHash = result.InputHash
+		summary = result.Summary
+	}
+
+	if d.Get("ytt_input_hash").(string) == inputHash {
+		return result, nil
+	}
+
+	err = d.SetNew("ytt_input_hash", inputHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, d.SetNew("ytt_summary", summary)
+}
+
+func resourceAppSetYttNewComputed(d *schema.ResourceDiff) error {
+	for _, key := range []string{"ytt_input_hash", "ytt_summary"} {
+		err := d.SetNewComputed(key)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -97,7 +389,9 @@ func resourceAppDelete(d *schema.ResourceData, meta interface{}) error {
 	name := d.Get("app").(string)
 	namespace := d.Get("namespace").(string)
 
-	err := kapp.NewDeleteRequest(c.DepsFactory, name, namespace).Execute()
+	policy := kapp.DeletePolicy(d.Get("delete_policy").(string))
+
+	err := kapp.NewDeleteRequest(c.DepsFactory, name, namespace, policy).Execute()
 	if err != nil {
 		return err
 	}
@@ -106,7 +400,7 @@ func resourceAppDelete(d *schema.ResourceData, meta interface{}) error {
 }
 
 func resourceAppRead(d *schema.ResourceData, meta interface{}) error {
-	return nil
+	return resourceAppRefreshClusterHash(d, meta)
 }
 
 func resourceAppExists(d *schema.ResourceData, meta interface{}) (bool, error) {
@@ -0,0 +1,675 @@
+package k14s
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/validation"
+	"github.com/niallthomson/terraform-provider-k14s/k14s/kappctrl"
+)
+
+const (
+	kappCtrlDefaultTimeout = 10 * time.Minute
+)
+
+func resourceKappControllerApp() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:        schema.TypeString,
+				Description: "The name of the custom resource",
+				Required:    true,
+				ForceNew:    true,
+			},
+			"namespace": {
+				Type:        schema.TypeString,
+				Description: "The namespace of the custom resource",
+				Required:    true,
+				ForceNew:    true,
+			},
+			"kind": {
+				Type:         schema.TypeString,
+				Description:  "Custom resource kind, App (kappctrl.k14s.io/v1alpha1) or PackageInstall (packaging.carvel.dev/v1alpha1)",
+				Optional:     true,
+				ForceNew:     true,
+				Default:      kappctrl.AppKind.Name,
+				ValidateFunc: validation.StringInSlice([]string{kappctrl.AppKind.Name, kappctrl.PackageInstallKind.Name}, false),
+			},
+			"service_account_name": {
+				Type:        schema.TypeString,
+				Description: "Service account used by kapp-controller to deploy resources",
+				Optional:    true,
+			},
+			"sync_period": {
+				Type:        schema.TypeString,
+				Description: "How often kapp-controller reconciles (e.g. 10m)",
+				Optional:    true,
+			},
+			"paused": {
+				Type:        schema.TypeBool,
+				Description: "Stop reconciling pending changes. Changes to paused resources are not waited for",
+				Optional:    true,
+			},
+			"canceled": {
+				Type:        schema.TypeBool,
+				Description: "Stop the current and future reconciles. Changes to canceled resources are not waited for",
+				Optional:    true,
+			},
+			"fetch": {
+				Type:        schema.TypeList,
+				Description: "App fetch steps, each with exactly one source",
+				Optional:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"path": {
+							Type:        schema.TypeString,
+							Description: "Directory the fetched contents are placed in",
+							Optional:    true,
+						},
+						"inline": kappCtrlBlockSchema("Inline files", map[string]*schema.Schema{
+							"paths": kappCtrlInlinePathsSchema(),
+						}),
+						"image": kappCtrlBlockSchema("Image with configuration", map[string]*schema.Schema{
+							"url":         kappCtrlStringSchema("Image reference (e.g. username/app1-config:v0.1.0)", true),
+							"secret_name": kappCtrlSecretNameSchema(),
+							"sub_path":    kappCtrlStringSchema("Directory within the image", false),
+						}),
+						"http": kappCtrlBlockSchema("HTTP(S) file or archive", map[string]*schema.Schema{
+							"url":         kappCtrlStringSchema("URL of a text, tgz or zip file", true),
+							"sha256":      kappCtrlStringSchema("Expected sha256 of the download", false),
+							"secret_name": kappCtrlSecretNameSchema(),
+							"sub_path":    kappCtrlStringSchema("Directory within the archive", false),
+						}),
+						"git": kappCtrlBlockSchema("Git repository", map[string]*schema.Schema{
+							"url":         kappCtrlStringSchema("Repository URL", true),
+							"ref":         kappCtrlStringSchema("Branch, tag or commit (e.g. origin/main)", false),
+							"secret_name": kappCtrlSecretNameSchema(),
+							"sub_path":    kappCtrlStringSchema("Directory within the repository", false),
+							"lfs_skip_smudge": {
+								Type:        schema.TypeBool,
+								Description: "Skip fetching Git LFS objects",
+								Optional:    true,
+							},
+						}),
+						"helm_chart": kappCtrlBlockSchema("Helm chart", map[string]*schema.Schema{
+							"name":                   kappCtrlStringSchema("Chart name (e.g. stable/redis)", true),
+							"version":                kappCtrlStringSchema("Chart version", false),
+							"repository_url":         kappCtrlStringSchema("Chart repository URL", false),
+							"repository_secret_name": kappCtrlStringSchema("Secret with chart repository credentials", false),
+						}),
+					},
+				},
+			},
+			"template": {
+				Type:        schema.TypeList,
+				Description: "App template steps, each with exactly one templating tool",
+				Optional:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"ytt": kappCtrlBlockSchema("Template with ytt", map[string]*schema.Schema{
+							"ignore_unknown_comments": {
+								Type:        schema.TypeBool,
+								Description: "Ignore comments that are not ytt annotations",
+								Optional:    true,
+							},
+							"strict": {
+								Type:        schema.TypeBool,
+								Description: "Use strict YAML parsing",
+								Optional:    true,
+							},
+							"paths": {
+								Type:        schema.TypeList,
+								Description: "Fetched paths to template",
+								Optional:    true,
+								Elem: &schema.Schema{
+									Type: schema.TypeString,
+								},
+							},
+							"inline_paths": kappCtrlInlinePathsSchema(),
+						}),
+						"kbld": kappCtrlBlockSchema("Resolve images with kbld", map[string]*schema.Schema{
+							"paths": {
+								Type:        schema.TypeList,
+								Description: "Paths to resolve, defaults to the previous step output",
+								Optional:    true,
+								Elem: &schema.Schema{
+									Type: schema.TypeString,
+								},
+							},
+						}),
+						"helm_template": kappCtrlBlockSchema("Template with helm template", map[string]*schema.Schema{
+							"values_secret_names": {
+								Type:        schema.TypeList,
+								Description: "Secrets with values files",
+								Optional:    true,
+								Elem: &schema.Schema{
+									Type: schema.TypeString,
+								},
+							},
+						}),
+					},
+				},
+			},
+			"deploy": {
+				Type:        schema.TypeList,
+				Description: "App deploy steps",
+				Optional:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"kapp": kappCtrlBlockSchema("Deploy with kapp", map[string]*schema.Schema{
+							"into_ns": kappCtrlStringSchema("Override namespace of all resources", false),
+							"map_ns": {
+								Type:        schema.TypeList,
+								Description: "Namespace mappings (format: src:dst)",
+								Optional:    true,
+								Elem: &schema.Schema{
+									Type: schema.TypeString,
+								},
+							},
+							"raw_options": {
+								Type:        schema.TypeList,
+								Description: "Additional kapp deploy flags",
+								Optional:    true,
+								Elem: &schema.Schema{
+									Type: schema.TypeString,
+								},
+							},
+							"delete_raw_options": {
+								Type:        schema.TypeList,
+								Description: "Additional kapp delete flags",
+								Optional:    true,
+								Elem: &schema.Schema{
+									Type: schema.TypeString,
+								},
+							},
+						}),
+					},
+				},
+			},
+			"package_ref": kappCtrlBlockSchema("Package installed by a PackageInstall", map[string]*schema.Schema{
+				"ref_name":            kappCtrlStringSchema("Package name (e.g. pkg.test.carvel.dev)", true),
+				"version_constraints": kappCtrlStringSchema("Version constraints (e.g. >=1.0.0)", false),
+			}),
+			"values_secret_names": {
+				Type:        schema.TypeList,
+				Description: "Secrets with PackageInstall data values",
+				Optional:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"friendly_description": {
+				Type:        schema.TypeString,
+				Description: "Reconcile status reported by kapp-controller",
+				Computed:    true,
+			},
+			"spec_hash": {
+				Type:        schema.TypeString,
+				Description: "sha256 of the custom resource spec, refreshed from the cluster so that changes made outside of Terraform are reverted by the next apply",
+				Computed:    true,
+			},
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(kappCtrlDefaultTimeout),
+			Update: schema.DefaultTimeout(kappCtrlDefaultTimeout),
+			Delete: schema.DefaultTimeout(kappCtrlDefaultTimeout),
+		},
+		Create:        resourceKappControllerAppCreate,
+		Read:          resourceKappControllerAppRead,
+		Update:        resourceKappControllerAppUpdate,
+		Delete:        resourceKappControllerAppDelete,
+		CustomizeDiff: resourceKappControllerAppCustomizeDiff,
+	}
+}
+
+func kappCtrlBlockSchema(description string, blockSchema map[string]*schema.Schema) *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Description: description,
+		Optional:    true,
+		MaxItems:    1,
+		Elem: &schema.Resource{
+			Schema: blockSchema,
+		},
+	}
+}
+
+func kappCtrlStringSchema(description string, required bool) *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeString,
+		Description: description,
+		Required:    required,
+		Optional:    !required,
+	}
+}
+
+func kappCtrlSecretNameSchema() *schema.Schema {
+	return kappCtrlStringSchema("Secret in the same namespace with credentials", false)
+}
+
+func kappCtrlInlinePathsSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeMap,
+		Description: "Map of file path to file contents",
+		Optional:    true,
+		Elem: &schema.Schema{
+			Type: schema.TypeString,
+		},
+	}
+}
+
+func resourceKappControllerAppCreate(d *schema.ResourceData, meta interface{}) error {
+	err := resourceKappControllerAppApply(d, meta, d.Timeout(schema.TimeoutCreate))
+
+	// Record the resource even if it failed to reconcile,
+	// so that it can be fixed by an update or deleted
+	if d.Id() == "" {
+		id := uuid.New().String()
+
+		d.SetId(id)
+	}
+
+	return err
+}
+
+func resourceKappControllerAppUpdate(d *schema.ResourceData, meta interface{}) error {
+	return resourceKappControllerAppApply(d, meta, d.Timeout(schema.TimeoutUpdate))
+}
+
+func resourceKappControllerAppApply(d *schema.ResourceData, meta interface{}, timeout time.Duration) error {
+	c := meta.(*Config)
+
+	kind, err := kappctrl.KindByName(d.Get("kind").(string))
+	if err != nil {
+		return err
+	}
+
+	spec, err := kappCtrlSpec(d, kind)
+	if err != nil {
+		return err
+	}
+
+	client, err := c.DepsFactory.DynamicClient()
+	if err != nil {
+		return err
+	}
+
+	obj := kind.NewObject(d.Get("name").(string), d.Get("namespace").(string), spec)
+
+	status, err := kappctrl.NewApplyRequest(client, kind, obj, timeout).Execute()
+
+	d.Set("friendly_description", status.FriendlyDescription)
+
+	specHash, hashErr := kappctrl.SpecHash(spec)
+	if hashErr != nil {
+		return hashErr
+	}
+
+	d.Set("spec_hash", specHash)
+
+	return err
+}
+
+func resourceKappControllerAppRead(d *schema.ResourceData, meta interface{}) error {
+	c := meta.(*Config)
+
+	kind, err := kappctrl.KindByName(d.Get("kind").(string))
+	if err != nil {
+		return err
+	}
+
+	client, err := c.DepsFactory.DynamicClient()
+	if err != nil {
+		return err
+	}
+
+	spec, status, found, err := kappctrl.Get(client, kind, d.Get("name").(string), d.Get("namespace").(string))
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		d.SetId("")
+		return nil
+	}
+
+	// The spec is not mapped back to individual attributes; a changed
+	// hash is planned as an update that reapplies the configured spec
+	specHash, err := kappctrl.SpecHash(spec)
+	if err != nil {
+		return err
+	}
+
+	d.Set("friendly_description", status.FriendlyDescription)
+	d.Set("spec_hash", specHash)
+
+	return nil
+}
+
+// resourceKappControllerAppCustomizeDiff plans a new spec_hash when the
+// configured spec differs from the one last read from the cluster
+func resourceKappControllerAppCustomizeDiff(d *schema.ResourceDiff, meta interface{}) error {
+	for key, keySchema := range resourceKappControllerApp().Schema {
+		if keySchema.Computed && !keySchema.Optional {
+			continue
+		}
+		if !d.NewValueKnown(key) {
+			return d.SetNewComputed("spec_hash")
+		}
+	}
+
+	kind, err := kappctrl.KindByName(d.Get("kind").(string))
+	if err != nil {
+		return err
+	}
+
+	spec, err := kappCtrlSpec(d, kind)
+	if err != nil {
+		return err
+	}
+
+	specHash, err := kappctrl.SpecHash(spec)
+	if err != nil {
+		return err
+	}
+
+	if specHash == d.Get("spec_hash").(string) {
+		return nil
+	}
+
+	return d.SetNew("spec_hash", specHash)
+}
+
+func resourceKappControllerAppDelete(d *schema.ResourceData, meta interface{}) error {
+	c := meta.(*Config)
+
+	kind, err := kappctrl.KindByName(d.Get("kind").(string))
+	if err != nil {
+		return err
+	}
+
+	client, err := c.DepsFactory.DynamicClient()
+	if err != nil {
+		return err
+	}
+
+	return kappctrl.NewDeleteRequest(client, kind, d.Get("name").(string),
+		d.Get("namespace").(string), d.Timeout(schema.TimeoutDelete)).Execute()
+}
+
+// kappCtrlSpec converts HCL blocks to the custom resource spec. Values are
+// limited to JSON compatible types so the object can be deep copied.
+func kappCtrlSpec(d yttResourceGetter, kind kappctrl.Kind) (map[string]interface{}, error) {
+	spec := map[string]interface{}{}
+
+	kappCtrlSetString(spec, "serviceAccountName", d.Get("service_account_name"))
+	kappCtrlSetString(spec, "syncPeriod", d.Get("sync_period"))
+
+	if d.Get("paused").(bool) {
+		spec["paused"] = true
+	}
+
+	if d.Get("canceled").(bool) {
+		spec["canceled"] = true
+	}
+
+	fetchParams := d.Get("fetch").([]interface{})
+	templateParams := d.Get("template").([]interface{})
+	deployParams := d.Get("deploy").([]interface{})
+	packageRefParams := d.Get("package_ref").([]interface{})
+	valuesSecretNames := d.Get("values_secret_names").([]interface{})
+
+	switch kind.Name {
+	case kappctrl.AppKind.Name:
+		if len(packageRefParams) > 0 || len(valuesSecretNames) > 0 {
+			return nil, fmt.Errorf("Expected package_ref and values_secret_names to only be used with kind PackageInstall")
+		}
+		if len(fetchParams) == 0 || len(templateParams) == 0 || len(deployParams) == 0 {
+			return nil, fmt.Errorf("Expected kind App to specify fetch, template and deploy")
+		}
+
+		var err error
+
+		spec["fetch"], err = kappCtrlSteps("fetch", fetchParams, kappCtrlFetchStep)
+		if err != nil {
+			return nil, err
+		}
+
+		spec["template"], err = kappCtrlSteps("template", templateParams, kappCtrlTemplateStep)
+		if err != nil {
+			return nil, err
+		}
+
+		spec["deploy"], err = kappCtrlSteps("deploy", deployParams, kappCtrlDeployStep)
+		if err != nil {
+			return nil, err
+		}
+
+	case kappctrl.PackageInstallKind.Name:
+		if len(fetchParams) > 0 || len(templateParams) > 0 || len(deployParams) > 0 {
+			return nil, fmt.Errorf("Expected fetch, template and deploy to only be used with kind App")
+		}
+
+		packageRef := kappCtrlBlock(packageRefParams)
+		if packageRef == nil {
+			return nil, fmt.Errorf("Expected kind PackageInstall to specify package_ref")
+		}
+
+		packageRefSpec := map[string]interface{}{
+			"refName": packageRef["ref_name"].(string),
+		}
+		if constraints := packageRef["version_constraints"].(string); constraints != "" {
+			packageRefSpec["versionSelection"] = map[string]interface{}{
+				"constraints": constraints,
+			}
+		}
+		spec["packageRef"] = packageRefSpec
+
+		if len(valuesSecretNames) > 0 {
+			var values []interface{}
+			for _, secretName := range expandStringSlice(valuesSecretNames) {
+				values = append(values, map[string]interface{}{
+					"secretRef": map[string]interface{}{"name": secretName},
+				})
+			}
+			spec["values"] = values
+		}
+	}
+
+	return spec, nil
+}
+
+func kappCtrlSteps(desc string, params []interface{}, stepFunc func(map[string]interface{}) (map[string]interface{}, error)) ([]interface{}, error) {
+	var steps []interface{}
+
+	for i, param := range params {
+		stepParams, _ := param.(map[string]interface{})
+		if stepParams == nil {
+			stepParams = map[string]interface{}{}
+		}
+
+		step, err := stepFunc(stepParams)
+		if err != nil {
+			return nil, fmt.Errorf("Building %s step %d: %s", desc, i, err)
+		}
+
+		if len(step) != 1 {
+			return nil, fmt.Errorf("Expected %s step %d to specify exactly one source", desc, i)
+		}
+
+		if path, ok := stepParams["path"].(string); ok && path != "" {
+			step["path"] = path
+		}
+
+		steps = append(steps, step)
+	}
+
+	return steps, nil
+}
+
+func kappCtrlFetchStep(params map[string]interface{}) (map[string]interface{}, error) {
+	step := map[string]interface{}{}
+
+	if inline := kappCtrlBlock(params["inline"].([]interface{})); inline != nil {
+		step["inline"] = map[string]interface{}{
+			"paths": kappCtrlStringMap(inline["paths"]),
+		}
+	}
+
+	if image := kappCtrlBlock(params["image"].([]interface{})); image != nil {
+		imageSpec := map[string]interface{}{"url": image["url"].(string)}
+		kappCtrlSetSecretRef(imageSpec, image["secret_name"])
+		kappCtrlSetString(imageSpec, "subPath", image["sub_path"])
+		step["image"] = imageSpec
+	}
+
+	if http := kappCtrlBlock(params["http"].([]interface{})); http != nil {
+		httpSpec := map[string]interface{}{"url": http["url"].(string)}
+		kappCtrlSetString(httpSpec, "sha256", http["sha256"])
+		kappCtrlSetSecretRef(httpSpec, http["secret_name"])
+		kappCtrlSetString(httpSpec, "subPath", http["sub_path"])
+		step["http"] = httpSpec
+	}
+
+	if git := kappCtrlBlock(params["git"].([]interface{})); git != nil {
+		gitSpec := map[string]interface{}{"url": git["url"].(string)}
+		kappCtrlSetString(gitSpec, "ref", git["ref"])
+		kappCtrlSetSecretRef(gitSpec, git["secret_name"])
+		kappCtrlSetString(gitSpec, "subPath", git["sub_path"])
+		if git["lfs_skip_smudge"].(bool) {
+			gitSpec["lfsSkipSmudge"] = true
+		}
+		step["git"] = gitSpec
+	}
+
+	if chart := kappCtrlBlock(params["helm_chart"].([]interface{})); chart != nil {
+		chartSpec := map[string]interface{}{"name": chart["name"].(string)}
+		kappCtrlSetString(chartSpec, "version", chart["version"])
+		if repoURL := chart["repository_url"].(string); repoURL != "" {
+			repoSpec := map[string]interface{}{"url": repoURL}
+			kappCtrlSetSecretRef(repoSpec, chart["repository_secret_name"])
+			chartSpec["repository"] = repoSpec
+		}
+		step["helmChart"] = chartSpec
+	}
+
+	return step, nil
+}
+
+func kappCtrlTemplateStep(params map[string]interface{}) (map[string]interface{}, error) {
+	step := map[string]interface{}{}
+
+	if ytt := kappCtrlBlock(params["ytt"].([]interface{})); ytt != nil {
+		yttSpec := map[string]interface{}{}
+		if val, _ := ytt["ignore_unknown_comments"].(bool); val {
+			yttSpec["ignoreUnknownComments"] = true
+		}
+		if val, _ := ytt["strict"].(bool); val {
+			yttSpec["strict"] = true
+		}
+		if paths, _ := ytt["paths"].([]interface{}); len(paths) > 0 {
+			yttSpec["paths"] = kappCtrlStringList(paths)
+		}
+		if inlinePaths := kappCtrlStringMap(ytt["inline_paths"]); len(inlinePaths) > 0 {
+			yttSpec["inline"] = map[string]interface{}{"paths": inlinePaths}
+		}
+		step["ytt"] = yttSpec
+	}
+
+	if kbld := kappCtrlBlock(params["kbld"].([]interface{})); kbld != nil {
+		kbldSpec := map[string]interface{}{}
+		if paths, _ := kbld["paths"].([]interface{}); len(paths) > 0 {
+			kbldSpec["paths"] = kappCtrlStringList(paths)
+		}
+		step["kbld"] = kbldSpec
+	}
+
+	if helmTemplate := kappCtrlBlock(params["helm_template"].([]interface{})); helmTemplate != nil {
+		helmTemplateSpec := map[string]interface{}{}
+		if secretNames, _ := helmTemplate["values_secret_names"].([]interface{}); len(secretNames) > 0 {
+			var valuesFrom []interface{}
+			for _, secretName := range expandStringSlice(secretNames) {
+				valuesFrom = append(valuesFrom, map[string]interface{}{
+					"secretRef": map[string]interface{}{"name": secretName},
+				})
+			}
+			helmTemplateSpec["valuesFrom"] = valuesFrom
+		}
+		step["helmTemplate"] = helmTemplateSpec
+	}
+
+	return step, nil
+}
+
+func kappCtrlDeployStep(params map[string]interface{}) (map[string]interface{}, error) {
+	step := map[string]interface{}{}
+
+	if kapp := kappCtrlBlock(params["kapp"].([]interface{})); kapp != nil {
+		kappSpec := map[string]interface{}{}
+		kappCtrlSetString(kappSpec, "intoNs", kapp["into_ns"])
+		if mapNs, _ := kapp["map_ns"].([]interface{}); len(mapNs) > 0 {
+			kappSpec["mapNs"] = kappCtrlStringList(mapNs)
+		}
+		if rawOpts, _ := kapp["raw_options"].([]interface{}); len(rawOpts) > 0 {
+			kappSpec["rawOptions"] = kappCtrlStringList(rawOpts)
+		}
+		if rawOpts, _ := kapp["delete_raw_options"].([]interface{}); len(rawOpts) > 0 {
+			kappSpec["delete"] = map[string]interface{}{
+				"rawOptions": kappCtrlStringList(rawOpts),
+			}
+		}
+		step["kapp"] = kappSpec
+	}
+
+	return step, nil
+}
+
+// kappCtrlBlock returns the single element of a MaxItems 1 block, or nil
+func kappCtrlBlock(params []interface{}) map[string]interface{} {
+	if len(params) == 0 {
+		return nil
+	}
+	return kappCtrlBlockOrEmpty(params)
+}
+
+// kappCtrlBlockOrEmpty handles blocks without any attributes set,
+// which are represented as a nil list element
+func kappCtrlBlockOrEmpty(params []interface{}) map[string]interface{} {
+	if len(params) > 0 {
+		if block, ok := params[0].(map[string]interface{}); ok {
+			return block
+		}
+	}
+	return map[string]interface{}{}
+}
+
+func kappCtrlSetString(obj map[string]interface{}, key string, val interface{}) {
+	if typedVal, _ := val.(string); typedVal != "" {
+		obj[key] = typedVal
+	}
+}
+
+func kappCtrlSetSecretRef(obj map[string]interface{}, secretName interface{}) {
+	if typedName, _ := secretName.(string); typedName != "" {
+		obj["secretRef"] = map[string]interface{}{"name": typedName}
+	}
+}
+
+func kappCtrlStringList(vals []interface{}) []interface{} {
+	var result []interface{}
+	for _, val := range expandStringSlice(vals) {
+		result = append(result, val)
+	}
+	return result
+}
+
+func kappCtrlStringMap(val interface{}) map[string]interface{} {
+	result := map[string]interface{}{}
+	typedVal, _ := val.(map[string]interface{})
+	for key, item := range typedVal {
+		result[key], _ = item.(string)
+	}
+	return result
+}
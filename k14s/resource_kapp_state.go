@@ -0,0 +1,309 @@
+package k14s
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/k14s/ytt/pkg/yamlmeta"
+	"github.com/niallthomson/terraform-provider-k14s/k14s/kapp"
+)
+
+const (
+	appStateModeFull   = "full"
+	appStateModeHashed = "hashed"
+)
+
+// appHashedInputKeys are inputs that are not stored in hashed state mode
+var appHashedInputKeys = []string{"config_yaml", "manifest"}
+
+// appHashedDeployKeys are the other arguments (and computed values
+// planned from them) that require a deploy in hashed state mode
+var appHashedDeployKeys = []string{"namespace", "files", "ytt", "ytt_input_hash", "state_mode"}
+
+func appStateSchema() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"resources_hash": {
+			Type:        schema.TypeString,
+			Description: "sha256 of normalised config_yaml and manifest resources (hashed state mode)",
+			Computed:    true,
+		},
+		"cluster_hash": {
+			Type:        schema.TypeString,
+			Description: "sha256 of the app resources as last applied by kapp, refreshed from the cluster (hashed state mode)",
+			Computed:    true,
+		},
+		"resources_yaml": {
+			Type:        schema.TypeString,
+			Description: "Normalised config_yaml and manifest resources to deploy. Only planned when a deploy happens and blank in state (hashed state mode)",
+			Computed:    true,
+			Sensitive:   true,
+		},
+		"resources": {
+			Type:        schema.TypeList,
+			Description: "config_yaml and manifest resources with Secret data and other kapp diff mask rule matches redacted (hashed state mode)",
+			Computed:    true,
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"kind": {
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+					"namespace": {
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+					"name": {
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+					"yaml": {
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+				},
+			},
+		},
+	}
+}
+
+type appResourcesState struct {
+	Hash      string
+	YAML      string
+	Resources []interface{}
+}
+
+// newAppResourcesState hashes and redacts config_yaml and manifest
+// documents, after normalising them the same way as manifest entries
+func newAppResourcesState(d yttResourceGetter) (appResourcesState, error) {
+	docs := []string{d.Get("config_yaml").(string)}
+	docs = append(docs, manifestList(d)...)
+
+	var normalisedYAML string
+
+	for _, doc := range docs {
+		objs, err := manifestObjects(doc)
+		if err != nil {
+			return appResourcesState{}, err
+		}
+
+		for _, obj := range objs {
+			delete(obj, "status")
+
+			objBytes, err := yamlmeta.PlainMarshal(obj)
+			if err != nil {
+				return appResourcesState{}, err
+			}
+
+			normalisedYAML += "---\n" + string(objBytes)
+		}
+	}
+
+	checksum := sha256.Sum256([]byte(normalisedYAML))
+
+	redactedResources, err := kapp.RedactedResources([]byte(normalisedYAML))
+	if err != nil {
+		return appResourcesState{}, fmt.Errorf("Redacting resources: %s", err)
+	}
+
+	resources := []interface{}{}
+
+	for _, res := range redactedResources {
+		resBytes, err := res.AsYAMLBytes()
+		if err != nil {
+			return appResourcesState{}, err
+		}
+
+		resources = append(resources, map[string]interface{}{
+			"kind":      res.Kind(),
+			"namespace": res.Namespace(),
+			"name":      res.Name(),
+			"yaml":      string(resBytes),
+		})
+	}
+
+	return appResourcesState{
+		Hash:      hex.EncodeToString(checksum[:]),
+		YAML:      normalisedYAML,
+		Resources: resources,
+	}, nil
+}
+
+// appClusterHash hashes kapp's last applied annotation of each app
+// resource, so that changes made by other kapp deploys or deleted
+// resources are noticed on refresh
+func appClusterHash(d *schema.ResourceData, meta interface{}) (string, error) {
+	c := meta.(*Config)
+
+	resources, exists, err := kapp.NewInspectRequest(c.DepsFactory, d.Get("app").(string), d.Get("namespace").(string)).Execute()
+	if err != nil {
+		return "", err
+	}
+
+	if !exists {
+		return "", nil
+	}
+
+	var entries []string
+
+	for _, res := range resources {
+		applied, found := res.Annotations()[kapp.AppliedResAnnKey]
+		if !found {
+			// e.g. Pods that carry app labels via templates
+			continue
+		}
+		entries = append(entries, res.Description()+"\n"+applied)
+	}
+
+	sort.Strings(entries)
+
+	checksum := sha256.Sum256([]byte(strings.Join(entries, "\n---\n")))
+
+	return hex.EncodeToString(checksum[:]), nil
+}
+
+// resourceAppHashedDiffSuppress hides config_yaml and manifest, which are
+// blank in state in hashed state mode. CustomizeDiff still reads their
+// configured values and plans resources_yaml when a deploy is needed.
+func resourceAppHashedDiffSuppress(k, old, new string, d *schema.ResourceData) bool {
+	return d.Id() != "" && d.Get("state_mode").(string) == appStateModeHashed
+}
+
+// appHashedInputs reads config_yaml from resources_yaml during apply, since
+// suppressed inputs are blank there
+type appHashedInputs struct {
+	*schema.ResourceData
+}
+
+func (d appHashedInputs) Get(key string) interface{} {
+	switch key {
+	case "config_yaml":
+		return d.ResourceData.Get("resources_yaml")
+	case "manifest":
+		return schema.NewSet(manifestHash, nil)
+	default:
+		return d.ResourceData.Get(key)
+	}
+}
+
+// resourceAppDeployInputs returns what a deploy reads its inputs from
+func resourceAppDeployInputs(d *schema.ResourceData) yttResourceGetter {
+	if d.Get("state_mode").(string) == appStateModeHashed {
+		return appHashedInputs{d}
+	}
+	return d
+}
+
+// resourceAppSetStateAfterDeploy records hashes and, in hashed state mode,
+// blanks inputs so that they are not kept in state
+func resourceAppSetStateAfterDeploy(d *schema.ResourceData, meta interface{}) error {
+	if d.Get("state_mode").(string) != appStateModeHashed {
+		d.Set("resources_hash", "")
+		d.Set("cluster_hash", "")
+		d.Set("resources", nil)
+		return nil
+	}
+
+	state, err := newAppResourcesState(resourceAppDeployInputs(d))
+	if err != nil {
+		return err
+	}
+
+	clusterHash, err := appClusterHash(d, meta)
+	if err != nil {
+		return err
+	}
+
+	d.Set("resources_hash", state.Hash)
+	d.Set("resources", state.Resources)
+	d.Set("cluster_hash", clusterHash)
+	d.Set("config_yaml", "")
+	d.Set("manifest", []interface{}{})
+	d.Set("resources_yaml", "")
+
+	return nil
+}
+
+// resourceAppRefreshClusterHash forgets resources_hash when the app was
+// changed outside of this resource, which makes the next plan deploy again
+func resourceAppRefreshClusterHash(d *schema.ResourceData, meta interface{}) error {
+	if d.Get("state_mode").(string) != appStateModeHashed {
+		return nil
+	}
+
+	clusterHash, err := appClusterHash(d, meta)
+	if err != nil {
+		return err
+	}
+
+	if clusterHash != d.Get("cluster_hash").(string) {
+		d.Set("resources_hash", "")
+		d.Set("cluster_hash", clusterHash)
+	}
+
+	return nil
+}
+
+// resourceAppCustomizeDiffState plans new hashes when hashed inputs change
+// and resources_yaml whenever a deploy happens, since deploying without
+// inputs would delete their resources
+func resourceAppCustomizeDiffState(d *schema.ResourceDiff) error {
+	if d.Get("state_mode").(string) != appStateModeHashed {
+		return nil
+	}
+
+	for _, key := range appHashedInputKeys {
+		if !d.NewValueKnown(key) {
+			for _, computedKey := range []string{"resources_hash", "cluster_hash", "resources", "resources_yaml"} {
+				err := d.SetNewComputed(computedKey)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	// Suppressed inputs are still read from configuration
+	state, err := newAppResourcesState(d)
+	if err != nil {
+		return err
+	}
+
+	// A rename deploys under the new name when the old app is missing
+	deploy := d.Id() == "" || d.HasChange("app")
+
+	for _, key := range appHashedDeployKeys {
+		if d.HasChange(key) {
+			deploy = true
+		}
+	}
+
+	if state.Hash != d.Get("resources_hash").(string) {
+		deploy = true
+
+		err = d.SetNew("resources_hash", state.Hash)
+		if err != nil {
+			return err
+		}
+
+		err = d.SetNew("resources", state.Resources)
+		if err != nil {
+			return err
+		}
+
+		err = d.SetNewComputed("cluster_hash")
+		if err != nil {
+			return err
+		}
+	}
+
+	if !deploy {
+		return nil
+	}
+
+	return d.SetNew("resources_yaml", state.YAML)
+}
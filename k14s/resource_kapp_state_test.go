@@ -0,0 +1,219 @@
+package k14s
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/terraform"
+	util "github.com/niallthomson/terraform-provider-k14s/k14s/util"
+)
+
+func TestAppHashedDiffRendersYttOncePerDiff(t *testing.T) {
+	requests := 0
+	template := "key: value\n"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		fmt.Fprint(w, template)
+	}))
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "kapp-state-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	config := &Config{HTTPFetcher: util.NewHTTPFetcher(time.Second, cacheDir)}
+
+	resource := resourceApp()
+
+	raw := map[string]interface{}{
+		"app":         "app",
+		"namespace":   "default",
+		"state_mode":  appStateModeHashed,
+		"config_yaml": manifestConfigMapA,
+		"manifest":    []interface{}{manifestConfigMapB, `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"c"}}`},
+		"ytt": []interface{}{
+			map[string]interface{}{"files": []interface{}{server.URL + "/config.yml"}},
+		},
+	}
+
+	d := schema.TestResourceDataRaw(t, resource.Schema, raw)
+
+	yttResult, err := resourceAppRenderYtt(d, config)
+	if err != nil {
+		t.Fatalf("Expected ytt to render: %s", err)
+	}
+
+	resourcesState, err := newAppResourcesState(d)
+	if err != nil {
+		t.Fatalf("Expected resources state: %s", err)
+	}
+
+	// State as left by a hashed deploy
+	d.SetId("test")
+	d.Set("config_yaml", "")
+	d.Set("manifest", []interface{}{})
+	d.Set("resources_hash", resourcesState.Hash)
+	d.Set("resources", resourcesState.Resources)
+	d.Set("cluster_hash", "")
+	d.Set("ytt_input_hash", yttResult.InputHash)
+	d.Set("ytt_summary", yttResult.Summary)
+
+	state := d.State()
+
+	requests = 0
+
+	diff, err := resource.Diff(state, terraform.NewResourceConfigRaw(raw), config)
+	if err != nil {
+		t.Fatalf("Expected diff to succeed: %s", err)
+	}
+	if diff != nil && !diff.Empty() {
+		t.Fatalf("Expected unchanged hashed inputs to be suppressed, but was: %#v", diff.Attributes)
+	}
+
+	if requests != 1 {
+		t.Fatalf("Expected ytt to be rendered once with the configured fetcher, but was fetched %d times", requests)
+	}
+
+	template = "key: changed\n"
+	requests = 0
+
+	diff, err = resource.Diff(state, terraform.NewResourceConfigRaw(raw), config)
+	if err != nil {
+		t.Fatalf("Expected diff to succeed: %s", err)
+	}
+
+	if diff == nil || diff.Attributes["ytt_input_hash"] == nil {
+		t.Fatalf("Expected changed ytt template to be planned, but was: %#v", diff)
+	}
+	if requests != 1 {
+		t.Fatalf("Expected ytt to be rendered once, but was fetched %d times", requests)
+	}
+
+	if diff.Attributes["config_yaml"] != nil || diff.Attributes["manifest.#"] != nil {
+		t.Fatalf("Expected hashed inputs to stay suppressed, but was: %#v", diff.Attributes)
+	}
+
+	resourcesYAML := diff.Attributes["resources_yaml"]
+	if resourcesYAML == nil || resourcesYAML.New != resourcesState.YAML || !resourcesYAML.Sensitive {
+		t.Fatalf("Expected deploy to plan sensitive resources_yaml with all hashed inputs, but was: %#v", resourcesYAML)
+	}
+
+	applied, err := schema.InternalMap(resource.Schema).Data(state, diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appliedState, err := newAppResourcesState(resourceAppDeployInputs(applied))
+	if err != nil {
+		t.Fatalf("Expected deploy inputs to be read from resources_yaml: %s", err)
+	}
+	if appliedState.Hash != resourcesState.Hash {
+		t.Fatalf("Expected deploy inputs to match configured inputs")
+	}
+}
+
+// appHashedTestState returns state as left by a hashed deploy of raw
+func appHashedTestState(t *testing.T, resource *schema.Resource, raw map[string]interface{}) *terraform.InstanceState {
+	t.Helper()
+
+	d := schema.TestResourceDataRaw(t, resource.Schema, raw)
+
+	resourcesState, err := newAppResourcesState(d)
+	if err != nil {
+		t.Fatalf("Expected resources state: %s", err)
+	}
+
+	d.SetId("test")
+	d.Set("config_yaml", "")
+	d.Set("manifest", []interface{}{})
+	d.Set("resources_hash", resourcesState.Hash)
+	d.Set("resources", resourcesState.Resources)
+
+	return d.State()
+}
+
+func TestAppHashedDiffPlansChangedInputs(t *testing.T) {
+	resource := resourceApp()
+
+	raw := map[string]interface{}{
+		"app":         "app",
+		"namespace":   "default",
+		"state_mode":  appStateModeHashed,
+		"config_yaml": manifestConfigMapA,
+		"manifest":    []interface{}{manifestConfigMapB},
+	}
+
+	state := appHashedTestState(t, resource, raw)
+
+	raw["manifest"] = []interface{}{`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"c"}}`}
+
+	diff, err := resource.Diff(state, terraform.NewResourceConfigRaw(raw), &Config{})
+	if err != nil {
+		t.Fatalf("Expected diff to succeed: %s", err)
+	}
+
+	if diff == nil || diff.Attributes["resources_hash"] == nil || diff.Attributes["resources_yaml"] == nil {
+		t.Fatalf("Expected changed manifest to plan a deploy, but was: %#v", diff)
+	}
+
+	resourcesYAML := diff.Attributes["resources_yaml"].New
+	if !strings.Contains(resourcesYAML, "name: c\n") || strings.Contains(resourcesYAML, "name: b\n") {
+		t.Fatalf("Expected resources_yaml to hold configured inputs, but was: %s", resourcesYAML)
+	}
+	if !strings.Contains(resourcesYAML, "name: a\n") {
+		t.Fatalf("Expected resources_yaml to hold config_yaml, but was: %s", resourcesYAML)
+	}
+}
+
+func TestAppHashedDiffPlansInputsForRename(t *testing.T) {
+	resource := resourceApp()
+
+	raw := map[string]interface{}{
+		"app":         "app",
+		"namespace":   "default",
+		"state_mode":  appStateModeHashed,
+		"config_yaml": manifestConfigMapA,
+		"manifest":    []interface{}{manifestConfigMapB},
+	}
+
+	state := appHashedTestState(t, resource, raw)
+
+	raw["app"] = "renamed"
+
+	diff, err := resource.Diff(state, terraform.NewResourceConfigRaw(raw), &Config{})
+	if err != nil {
+		t.Fatalf("Expected diff to succeed: %s", err)
+	}
+
+	if diff == nil || diff.Attributes["resources_yaml"] == nil {
+		t.Fatalf("Expected rename to plan inputs for deploying under the new name, but was: %#v", diff)
+	}
+	if diff.Attributes["resources_hash"] != nil {
+		t.Fatalf("Expected unchanged inputs to keep resources_hash, but was: %#v", diff.Attributes["resources_hash"])
+	}
+
+	applied, err := schema.InternalMap(resource.Schema).Data(state, diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inputs := resourceAppDeployInputs(applied)
+
+	yaml, _, err := resourceAppCombineInputs(inputs, &Config{}, nil)
+	if err != nil {
+		t.Fatalf("Expected deploy inputs to combine: %s", err)
+	}
+	if !strings.Contains(yaml, "name: a\n") || !strings.Contains(yaml, "name: b\n") {
+		t.Fatalf("Expected deploy after a rename to include all inputs, but was: %s", yaml)
+	}
+}
@@ -0,0 +1,115 @@
+package k14s
+
+import (
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+)
+
+func resourceYttTemplate() *schema.Resource {
+	s := yttSchema()
+
+	// Inputs are updated in place, outputs only change with input_hash
+	s["input_hash"] = &schema.Schema{
+		Type:        schema.TypeString,
+		Description: "Hash of all template inputs used to render the stored output",
+		Computed:    true,
+	}
+
+	return &schema.Resource{
+		Schema:        s,
+		Create:        resourceYttTemplateCreate,
+		Read:          resourceYttTemplateRead,
+		Update:        resourceYttTemplateUpdate,
+		Delete:        resourceYttTemplateDelete,
+		CustomizeDiff: resourceYttTemplateCustomizeDiff,
+	}
+}
+
+func resourceYttTemplateCreate(d *schema.ResourceData, meta interface{}) error {
+	err := resourceYttTemplateRender(d, meta)
+	if err != nil {
+		return err
+	}
+
+	id := uuid.New().String()
+
+	d.SetId(id)
+
+	return nil
+}
+
+func resourceYttTemplateUpdate(d *schema.ResourceData, meta interface{}) error {
+	return resourceYttTemplateRender(d, meta)
+}
+
+func resourceYttTemplateRender(d *schema.ResourceData, meta interface{}) error {
+	result, err := yttRender(d, httpFetcher(meta))
+	if err != nil {
+		return err
+	}
+
+	d.Set("input_hash", result.InputHash)
+
+	for key, value := range result.Attributes {
+		d.Set(key, value)
+	}
+
+	return nil
+}
+
+// Output recorded at apply time is kept as is, so refresh never changes it
+func resourceYttTemplateRead(d *schema.ResourceData, meta interface{}) error {
+	return nil
+}
+
+func resourceYttTemplateDelete(d *schema.ResourceData, meta interface{}) error {
+	d.SetId("")
+	return nil
+}
+
+func resourceYttTemplateCustomizeDiff(d *schema.ResourceDiff, meta interface{}) error {
+	for key, keySchema := range yttSchema() {
+		if keySchema.Computed && !keySchema.Optional {
+			continue
+		}
+		if !d.NewValueKnown(key) {
+			log.Printf("[DEBUG] Input %s is not known yet, deferring ytt rendering to apply", key)
+			return resourceYttTemplateSetNewComputed(d)
+		}
+	}
+
+	result, err := yttRender(d, httpFetcher(meta))
+	if err != nil {
+		return err
+	}
+
+	if d.Id() != "" && d.Get("input_hash").(string) == result.InputHash {
+		return nil
+	}
+
+	err = d.SetNew("input_hash", result.InputHash)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range result.Attributes {
+		err := d.SetNew(key, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func resourceYttTemplateSetNewComputed(d *schema.ResourceDiff) error {
+	for _, key := range append([]string{"input_hash"}, yttOutputKeys...) {
+		err := d.SetNewComputed(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package k14s
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/terraform"
+)
+
+func TestYttTemplateDiffStableOutput(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "ytt-template-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	templatePath := filepath.Join(baseDir, "config.yml")
+
+	err = ioutil.WriteFile(templatePath, []byte("key: value\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resource := resourceYttTemplate()
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"base_dir": baseDir,
+		"files":    []interface{}{"config.yml"},
+	})
+
+	diff, err := resource.Diff(nil, config, &Config{})
+	if err != nil {
+		t.Fatalf("Expected diff to succeed: %s", err)
+	}
+
+	if diff.Attributes["result"] == nil || diff.Attributes["result"].New != "key: value\n" {
+		t.Fatalf("Expected result to be rendered during plan, but was: %#v", diff.Attributes["result"])
+	}
+
+	state, err := resource.Apply(nil, diff, &Config{})
+	if err != nil {
+		t.Fatalf("Expected apply to succeed: %s", err)
+	}
+
+	inputHash := state.Attributes["input_hash"]
+	if inputHash == "" || state.Attributes["result"] != "key: value\n" {
+		t.Fatalf("Expected rendered output in state, but was: %#v", state.Attributes)
+	}
+
+	// Same inputs keep the same input_hash, so nothing is planned
+	diff, err = resource.Diff(state, config, &Config{})
+	if err != nil {
+		t.Fatalf("Expected diff to succeed: %s", err)
+	}
+	if diff != nil && !diff.Empty() {
+		t.Fatalf("Expected unchanged inputs to not plan changes, but was: %#v", diff.Attributes)
+	}
+
+	// Refresh keeps the stored output
+	refreshed, err := resource.RefreshWithoutUpgrade(state, &Config{})
+	if err != nil {
+		t.Fatalf("Expected refresh to succeed: %s", err)
+	}
+	if refreshed.Attributes["input_hash"] != inputHash || refreshed.Attributes["result"] != "key: value\n" {
+		t.Fatalf("Expected refresh to keep the stored output, but was: %#v", refreshed.Attributes)
+	}
+
+	// Template contents are part of the input hash
+	err = ioutil.WriteFile(templatePath, []byte("key: changed\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err = resource.Diff(state, config, &Config{})
+	if err != nil {
+		t.Fatalf("Expected diff to succeed: %s", err)
+	}
+
+	if diff == nil || diff.Attributes["input_hash"] == nil || diff.Attributes["input_hash"].New == inputHash {
+		t.Fatalf("Expected changed template to plan a new input_hash, but was: %#v", diff)
+	}
+	if diff.Attributes["result"] == nil || diff.Attributes["result"].New != "key: changed\n" {
+		t.Fatalf("Expected changed template to plan new output, but was: %#v", diff.Attributes["result"])
+	}
+}
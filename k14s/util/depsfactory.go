@@ -2,48 +2,95 @@ package util
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
 
+type DepsFactoryOpts struct {
+	QPS     float32
+	Burst   int
+	Timeout time.Duration
+}
+
 type DepsFactoryImpl struct {
 	config *rest.Config
+	opts   DepsFactoryOpts
 
-	client *kubernetes.Clientset
+	lock          sync.Mutex
+	dynamicClient dynamic.Interface
+	client        *kubernetes.Clientset
+	discovery     *SharedDiscoveryCache
 }
 
-func NewDepsFactoryImpl(config *rest.Config) *DepsFactoryImpl {
-	return &DepsFactoryImpl{config: config}
+func NewDepsFactoryImpl(config *rest.Config, opts DepsFactoryOpts) *DepsFactoryImpl {
+	return &DepsFactoryImpl{config: config, opts: opts}
 }
 
 func (f *DepsFactoryImpl) DynamicClient() (dynamic.Interface, error) {
-	f.config.QPS = 1000
-	f.config.Burst = 1000
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.dynamicClient != nil {
+		return f.dynamicClient, nil
+	}
 
-	clientset, err := dynamic.NewForConfig(f.config)
+	config, err := f.restConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := dynamic.NewForConfig(config)
 	if err != nil {
 		return nil, fmt.Errorf("Building Dynamic clientset: %s", err)
 	}
 
+	f.dynamicClient = clientset
+
 	return clientset, nil
 }
 
 func (f *DepsFactoryImpl) CoreClient() (kubernetes.Interface, error) {
-	if f.client != nil {
-		return f.client, nil
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.client == nil {
+		config, err := f.restConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		clientset, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("Building Core clientset: %s", err)
+		}
+
+		f.client = clientset
+		f.discovery = NewSharedDiscoveryCache(clientset.Discovery())
 	}
 
-	f.config.QPS = 1000
-	f.config.Burst = 1000
+	// Each caller gets its own view onto the shared discovery cache
+	// so that repeated lookups by one kapp request still hit the server
+	return &cachedDiscoveryClientset{
+		Clientset: f.client,
+		discovery: f.discovery.NewView(),
+	}, nil
+}
 
-	clientset, err := kubernetes.NewForConfig(f.config)
-	if err != nil {
-		return nil, fmt.Errorf("Building Core clientset: %s", err)
+func (f *DepsFactoryImpl) restConfig() (*rest.Config, error) {
+	if f.config == nil {
+		return nil, fmt.Errorf("Kubernetes client configuration is not available, check the provider configuration")
 	}
 
-	return clientset, nil
+	config := rest.CopyConfig(f.config)
+	config.QPS = f.opts.QPS
+	config.Burst = f.opts.Burst
+	config.Timeout = f.opts.Timeout
+
+	return config, nil
 }
 
 func Resolver(returnVal string) func() (string, error) {
@@ -0,0 +1,99 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+// newDiscoveryTestServer serves core API discovery, counting fetches of
+// the API versions that start each discovery
+func newDiscoveryTestServer(fetches *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch req.URL.Path {
+		case "/api":
+			atomic.AddInt32(fetches, 1)
+			time.Sleep(50 * time.Millisecond)
+			fmt.Fprint(w, `{"kind":"APIVersions","versions":["v1"]}`)
+		case "/apis":
+			fmt.Fprint(w, `{"kind":"APIGroupList","groups":[]}`)
+		case "/api/v1":
+			fmt.Fprint(w, `{"kind":"APIResourceList","groupVersion":"v1","resources":[{"name":"configmaps","kind":"ConfigMap","namespaced":true,"verbs":["get"]}]}`)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+}
+
+func TestDepsFactoryConcurrentCoreClients(t *testing.T) {
+	var fetches int32
+
+	server := newDiscoveryTestServer(&fetches)
+	defer server.Close()
+
+	depsFactory := NewDepsFactoryImpl(&rest.Config{Host: server.URL}, DepsFactoryOpts{QPS: 100, Burst: 100})
+
+	const callers = 10
+
+	var wg sync.WaitGroup
+	discoveries := make([]discovery.DiscoveryInterface, callers)
+
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			coreClient, err := depsFactory.CoreClient()
+			if err != nil {
+				t.Errorf("Expected core client: %s", err)
+				return
+			}
+
+			discoveries[i] = coreClient.Discovery()
+
+			serverResources, err := coreClient.Discovery().ServerResources()
+			if err != nil {
+				t.Errorf("Expected discovery to succeed: %s", err)
+				return
+			}
+
+			if len(serverResources) != 1 || serverResources[0].APIResources[0].Kind != "ConfigMap" {
+				t.Errorf("Expected discovered resources, but was %#v", serverResources)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if fetches := atomic.LoadInt32(&fetches); fetches != 1 {
+		t.Fatalf("Expected concurrent callers to share one discovery fetch, but was %d fetches", fetches)
+	}
+
+	seenDiscoveries := map[discovery.DiscoveryInterface]struct{}{}
+	for _, view := range discoveries {
+		seenDiscoveries[view] = struct{}{}
+	}
+
+	if len(seenDiscoveries) != callers {
+		t.Fatalf("Expected each caller to get its own discovery view, but was %d views", len(seenDiscoveries))
+	}
+
+	// A view that was used goes to the server again
+	_, err := discoveries[0].ServerResources()
+	if err != nil {
+		t.Fatalf("Expected discovery to succeed: %s", err)
+	}
+
+	if fetches := atomic.LoadInt32(&fetches); fetches != 2 {
+		t.Fatalf("Expected used view to fetch again, but was %d fetches", fetches)
+	}
+}
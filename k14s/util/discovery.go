@@ -0,0 +1,98 @@
+package util
+
+import (
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+)
+
+// SharedDiscoveryCache remembers the last successful list of server
+// resources so that separate kapp requests within one provider process
+// do not each repeat full API discovery.
+type SharedDiscoveryCache struct {
+	delegate discovery.DiscoveryInterface
+
+	// fetchLock makes views that start at the same time share one fetch
+	fetchLock sync.Mutex
+
+	lock            sync.RWMutex
+	serverResources []*metav1.APIResourceList
+}
+
+func NewSharedDiscoveryCache(delegate discovery.DiscoveryInterface) *SharedDiscoveryCache {
+	return &SharedDiscoveryCache{delegate: delegate}
+}
+
+func (c *SharedDiscoveryCache) NewView() discovery.DiscoveryInterface {
+	return &discoveryView{DiscoveryInterface: c.delegate, cache: c}
+}
+
+func (c *SharedDiscoveryCache) cached() []*metav1.APIResourceList {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.serverResources
+}
+
+// cachedOrFetch waits for any fetch in progress before fetching itself
+func (c *SharedDiscoveryCache) cachedOrFetch() ([]*metav1.APIResourceList, error) {
+	c.fetchLock.Lock()
+	defer c.fetchLock.Unlock()
+
+	if serverResources := c.cached(); serverResources != nil {
+		return serverResources, nil
+	}
+
+	return c.fetch()
+}
+
+func (c *SharedDiscoveryCache) fetch() ([]*metav1.APIResourceList, error) {
+	serverResources, err := c.delegate.ServerResources()
+	if err == nil {
+		c.lock.Lock()
+		c.serverResources = serverResources
+		c.lock.Unlock()
+	}
+
+	return serverResources, err
+}
+
+// discoveryView serves the first ServerResources call from the shared
+// cache and goes to the server afterwards. kapp memoizes resource types
+// itself and only asks again when it failed to find a type (e.g. a CRD
+// that was just created), in which case fresh data is required.
+type discoveryView struct {
+	discovery.DiscoveryInterface
+
+	cache *SharedDiscoveryCache
+
+	lock sync.Mutex
+	used bool
+}
+
+func (v *discoveryView) ServerResources() ([]*metav1.APIResourceList, error) {
+	v.lock.Lock()
+	used := v.used
+	v.used = true
+	v.lock.Unlock()
+
+	if !used {
+		return v.cache.cachedOrFetch()
+	}
+
+	return v.cache.fetch()
+}
+
+type cachedDiscoveryClientset struct {
+	*kubernetes.Clientset
+
+	discovery discovery.DiscoveryInterface
+}
+
+var _ kubernetes.Interface = &cachedDiscoveryClientset{}
+
+func (c *cachedDiscoveryClientset) Discovery() discovery.DiscoveryInterface {
+	return c.discovery
+}
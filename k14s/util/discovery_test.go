@@ -0,0 +1,99 @@
+package util
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+)
+
+// countingDiscovery counts ServerResources calls and makes them slow
+// enough for concurrent callers to overlap
+type countingDiscovery struct {
+	discovery.DiscoveryInterface
+
+	calls int32
+}
+
+func (d *countingDiscovery) ServerResources() ([]*metav1.APIResourceList, error) {
+	call := atomic.AddInt32(&d.calls, 1)
+	time.Sleep(50 * time.Millisecond)
+
+	return []*metav1.APIResourceList{{GroupVersion: "v1", APIResources: []metav1.APIResource{
+		{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, ShortNames: []string{strconv.Itoa(int(call))}},
+	}}}, nil
+}
+
+func TestSharedDiscoveryCacheConcurrentViews(t *testing.T) {
+	delegate := &countingDiscovery{}
+	cache := NewSharedDiscoveryCache(delegate)
+
+	const callers = 10
+
+	var wg sync.WaitGroup
+	views := make([]discovery.DiscoveryInterface, callers)
+	results := make([][]*metav1.APIResourceList, callers)
+
+	for i := 0; i < callers; i++ {
+		views[i] = cache.NewView()
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			serverResources, err := views[i].ServerResources()
+			if err != nil {
+				t.Errorf("Expected discovery to succeed: %s", err)
+			}
+			results[i] = serverResources
+		}(i)
+	}
+
+	wg.Wait()
+
+	if calls := atomic.LoadInt32(&delegate.calls); calls != 1 {
+		t.Fatalf("Expected concurrent views to share one fetch, but was %d fetches", calls)
+	}
+
+	for _, result := range results {
+		if len(result) != 1 || result[0].APIResources[0].ShortNames[0] != "1" {
+			t.Fatalf("Expected all views to get the shared result, but was %#v", result)
+		}
+	}
+
+	// Views ask the server again once used, e.g. after a CRD was created
+	var refreshed []*metav1.APIResourceList
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+
+		var err error
+		refreshed, err = views[0].ServerResources()
+		if err != nil {
+			t.Errorf("Expected discovery to succeed: %s", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+
+		_, err := cache.NewView().ServerResources()
+		if err != nil {
+			t.Errorf("Expected discovery to succeed: %s", err)
+		}
+	}()
+
+	wg.Wait()
+
+	if calls := atomic.LoadInt32(&delegate.calls); calls != 2 {
+		t.Fatalf("Expected only the used view to fetch again, but was %d fetches", calls)
+	}
+
+	if refreshed[0].APIResources[0].ShortNames[0] != "2" {
+		t.Fatalf("Expected used view to get fresh results, but was %#v", refreshed)
+	}
+}
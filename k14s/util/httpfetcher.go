@@ -0,0 +1,170 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	httpFetcherChecksumPrefix = "sha256="
+	httpFetcherDefaultName    = "file.yml"
+)
+
+// HTTPFetcher downloads HTTP(S) sources into a content addressed on-disk
+// cache. Sources may be pinned with a URL fragment (e.g.
+// https://host/config.yml#sha256=<hex>), in which case a cached copy is
+// used without network access and a download with different contents
+// fails. Unpinned sources are downloaded on every fetch since their
+// contents may change; the cache is only read for pinned sources.
+type HTTPFetcher struct {
+	client   *http.Client
+	cacheDir string
+}
+
+func NewHTTPFetcher(timeout time.Duration, cacheDir string) *HTTPFetcher {
+	return &HTTPFetcher{
+		client:   &http.Client{Timeout: timeout},
+		cacheDir: cacheDir,
+	}
+}
+
+// DefaultHTTPCacheDir is used when the provider does not configure one
+func DefaultHTTPCacheDir() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	return filepath.Join(cacheDir, "terraform-provider-k14sx", "http")
+}
+
+func IsHTTPSource(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// Fetch returns a local path to the contents of source. The file keeps
+// the base name of the URL so tools that detect file types by extension
+// keep working.
+func (f *HTTPFetcher) Fetch(source string) (string, error) {
+	sourceURL, expectedChecksum, err := f.parseSource(source)
+	if err != nil {
+		return "", err
+	}
+
+	name := path.Base(sourceURL.Path)
+	if name == "/" || name == "." {
+		name = httpFetcherDefaultName
+	}
+
+	if expectedChecksum != "" {
+		cachedPath := f.cachedPath(expectedChecksum, name)
+		if _, err := os.Stat(cachedPath); err == nil {
+			return cachedPath, nil
+		}
+	}
+
+	data, err := f.download(sourceURL.String())
+	if err != nil {
+		return "", err
+	}
+
+	checksum := sha256.Sum256(data)
+	actualChecksum := hex.EncodeToString(checksum[:])
+
+	if expectedChecksum != "" && expectedChecksum != actualChecksum {
+		return "", fmt.Errorf("Expected sha256 of '%s' to be '%s', but was '%s'",
+			sourceURL.String(), expectedChecksum, actualChecksum)
+	}
+
+	return f.store(actualChecksum, name, data)
+}
+
+func (f *HTTPFetcher) parseSource(source string) (*url.URL, string, error) {
+	sourceURL, err := url.Parse(source)
+	if err != nil {
+		return nil, "", fmt.Errorf("Parsing URL '%s': %s", source, err)
+	}
+
+	var checksum string
+
+	if sourceURL.Fragment != "" {
+		if !strings.HasPrefix(sourceURL.Fragment, httpFetcherChecksumPrefix) {
+			return nil, "", fmt.Errorf("Expected URL '%s' fragment to be in format sha256=<hex>", source)
+		}
+
+		checksum = strings.ToLower(strings.TrimPrefix(sourceURL.Fragment, httpFetcherChecksumPrefix))
+		if _, err := hex.DecodeString(checksum); err != nil || len(checksum) != sha256.Size*2 {
+			return nil, "", fmt.Errorf("Expected URL '%s' to have a valid sha256 checksum", source)
+		}
+
+		sourceURL.Fragment = ""
+	}
+
+	return sourceURL, checksum, nil
+}
+
+func (f *HTTPFetcher) download(sourceURL string) ([]byte, error) {
+	resp, err := f.client.Get(sourceURL)
+	if err != nil {
+		return nil, fmt.Errorf("Requesting URL '%s': %s", sourceURL, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("Requesting URL '%s': %s", sourceURL, resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Reading URL '%s': %s", sourceURL, err)
+	}
+
+	return data, nil
+}
+
+func (f *HTTPFetcher) cachedPath(checksum, name string) string {
+	return filepath.Join(f.cacheDir, checksum, name)
+}
+
+func (f *HTTPFetcher) store(checksum, name string, data []byte) (string, error) {
+	cachedPath := f.cachedPath(checksum, name)
+
+	err := os.MkdirAll(filepath.Dir(cachedPath), 0700)
+	if err != nil {
+		return "", fmt.Errorf("Creating cache directory: %s", err)
+	}
+
+	// Write to a temporary file first so that concurrent readers never see
+	// partially written contents
+	tmpFile, err := ioutil.TempFile(filepath.Dir(cachedPath), ".download-")
+	if err != nil {
+		return "", fmt.Errorf("Creating cache file: %s", err)
+	}
+
+	_, err = tmpFile.Write(data)
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return "", fmt.Errorf("Writing cache file: %s", err)
+	}
+
+	err = os.Rename(tmpFile.Name(), cachedPath)
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return "", fmt.Errorf("Writing cache file: %s", err)
+	}
+
+	return cachedPath, nil
+}
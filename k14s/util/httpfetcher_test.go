@@ -0,0 +1,193 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testContents = "key: value\n"
+
+func testChecksum(contents string) string {
+	checksum := sha256.Sum256([]byte(contents))
+	return hex.EncodeToString(checksum[:])
+}
+
+func newTestFetcher(t *testing.T, timeout time.Duration) (*HTTPFetcher, func()) {
+	cacheDir, err := ioutil.TempDir("", "httpfetcher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewHTTPFetcher(timeout, cacheDir), func() { os.RemoveAll(cacheDir) }
+}
+
+func TestHTTPFetcherFetch(t *testing.T) {
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		fmt.Fprint(w, testContents)
+	}))
+	defer server.Close()
+
+	fetcher, cleanup := newTestFetcher(t, 5*time.Second)
+	defer cleanup()
+
+	path, err := fetcher.Fetch(server.URL + "/config/app.yml")
+	if err != nil {
+		t.Fatalf("Expected fetch to succeed: %s", err)
+	}
+
+	if filepath.Base(path) != "app.yml" {
+		t.Fatalf("Expected fetched file to keep URL base name, but was '%s'", path)
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil || string(contents) != testContents {
+		t.Fatalf("Expected fetched contents '%s', but was '%s' (%v)", testContents, contents, err)
+	}
+
+	// Unpinned URLs are always downloaded
+	_, err = fetcher.Fetch(server.URL + "/config/app.yml")
+	if err != nil {
+		t.Fatalf("Expected fetch to succeed: %s", err)
+	}
+
+	if requests != 2 {
+		t.Fatalf("Expected unpinned URL to be downloaded on every fetch, but was requested %d times", requests)
+	}
+
+	path, err = fetcher.Fetch(server.URL + "/")
+	if err != nil {
+		t.Fatalf("Expected fetch to succeed: %s", err)
+	}
+
+	if filepath.Base(path) != httpFetcherDefaultName {
+		t.Fatalf("Expected URL without file name to use default name, but was '%s'", path)
+	}
+}
+
+func TestHTTPFetcherPinnedCacheHit(t *testing.T) {
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		fmt.Fprint(w, testContents)
+	}))
+
+	fetcher, cleanup := newTestFetcher(t, 5*time.Second)
+	defer cleanup()
+
+	source := server.URL + "/app.yml#sha256=" + testChecksum(testContents)
+
+	firstPath, err := fetcher.Fetch(source)
+	if err != nil {
+		t.Fatalf("Expected fetch to succeed: %s", err)
+	}
+
+	// Pinned sources are served from cache without network access
+	server.Close()
+
+	secondPath, err := fetcher.Fetch(source)
+	if err != nil {
+		t.Fatalf("Expected pinned fetch to be served from cache: %s", err)
+	}
+
+	if firstPath != secondPath || requests != 1 {
+		t.Fatalf("Expected cached path '%s' without download, but was '%s' after %d requests", firstPath, secondPath, requests)
+	}
+
+	// Uppercase checksums refer to the same cache entry
+	thirdPath, err := fetcher.Fetch(server.URL + "/app.yml#sha256=" + strings.ToUpper(testChecksum(testContents)))
+	if err != nil || thirdPath != firstPath {
+		t.Fatalf("Expected uppercase checksum to hit cache, but was '%s' (%v)", thirdPath, err)
+	}
+}
+
+func TestHTTPFetcherChecksumMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, "changed: true\n")
+	}))
+	defer server.Close()
+
+	fetcher, cleanup := newTestFetcher(t, 5*time.Second)
+	defer cleanup()
+
+	_, err := fetcher.Fetch(server.URL + "/app.yml#sha256=" + testChecksum(testContents))
+	if err == nil || !strings.Contains(err.Error(), "Expected sha256") {
+		t.Fatalf("Expected checksum mismatch to fail, but was: %v", err)
+	}
+
+	// Mismatched contents are not cached under the expected checksum
+	if _, err := os.Stat(fetcher.cachedPath(testChecksum(testContents), "app.yml")); err == nil {
+		t.Fatalf("Expected mismatched contents to not be cached as pinned checksum")
+	}
+}
+
+func TestHTTPFetcherInvalidSources(t *testing.T) {
+	fetcher, cleanup := newTestFetcher(t, 5*time.Second)
+	defer cleanup()
+
+	sources := []string{
+		"https://example.com/app.yml#md5=abc",
+		"https://example.com/app.yml#sha256=xyz",
+		"https://example.com/app.yml#sha256=" + testChecksum(testContents)[:10],
+	}
+
+	for _, source := range sources {
+		_, err := fetcher.Fetch(source)
+		if err == nil {
+			t.Fatalf("Expected source '%s' to be rejected", source)
+		}
+	}
+}
+
+func TestHTTPFetcherNon2xx(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusInternalServerError, http.StatusMultipleChoices} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(status)
+			fmt.Fprint(w, testContents)
+		}))
+
+		fetcher, cleanup := newTestFetcher(t, 5*time.Second)
+
+		_, err := fetcher.Fetch(server.URL + "/app.yml")
+
+		cleanup()
+		server.Close()
+
+		if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("%d", status)) {
+			t.Fatalf("Expected status %d to fail, but was: %v", status, err)
+		}
+	}
+}
+
+func TestHTTPFetcherTimeout(t *testing.T) {
+	done := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	fetcher, cleanup := newTestFetcher(t, 100*time.Millisecond)
+	defer cleanup()
+
+	_, err := fetcher.Fetch(server.URL + "/app.yml")
+	if err == nil || !strings.Contains(err.Error(), "Requesting URL") {
+		t.Fatalf("Expected fetch to time out, but was: %v", err)
+	}
+}
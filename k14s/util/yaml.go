@@ -0,0 +1,52 @@
+package util
+
+import (
+	"fmt"
+
+	"github.com/k14s/ytt/pkg/orderedmap"
+)
+
+// UnorderedStringMaps converts ytt ordered maps into plain maps like
+// orderedmap.Conversion, but returns an error for keys that are not
+// strings (e.g. YAML booleans) instead of panicking
+func UnorderedStringMaps(val interface{}) (interface{}, error) {
+	switch typedVal := val.(type) {
+	case *orderedmap.Map:
+		result := map[string]interface{}{}
+
+		var err error
+
+		typedVal.Iterate(func(k, v interface{}) {
+			if err != nil {
+				return
+			}
+
+			key, ok := k.(string)
+			if !ok {
+				err = fmt.Errorf("Expected map key '%v' to be a string, but was %T", k, k)
+				return
+			}
+
+			result[key], err = UnorderedStringMaps(v)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return result, nil
+
+	case []interface{}:
+		result := make([]interface{}, len(typedVal))
+		for i, item := range typedVal {
+			var err error
+			result[i], err = UnorderedStringMaps(item)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+
+	default:
+		return val, nil
+	}
+}
@@ -0,0 +1,359 @@
+package vendir
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/k14s/ytt/pkg/yamlmeta"
+	util "github.com/niallthomson/terraform-provider-k14s/k14s/util"
+)
+
+const (
+	configAPIVersion = "vendir.k14s.io/v1alpha1"
+	configKind       = "Config"
+	lockConfigKind   = "LockConfig"
+)
+
+// Content source types that can be synced without network access
+const (
+	SourceDirectory = "directory"
+	SourceManual    = "manual"
+	SourceInline    = "inline"
+)
+
+// unsupportedSources are vendir content sources that need network access
+var unsupportedSources = []string{"git", "http", "image", "imgpkgBundle", "githubRelease", "helmChart"}
+
+// Config mirrors the subset of vendir's Config that is synced in process
+type Config struct {
+	Directories []Directory
+}
+
+type Directory struct {
+	Path     string
+	Contents []Content
+}
+
+type Content struct {
+	Path         string
+	Source       string
+	IncludePaths []string
+	ExcludePaths []string
+	// LegalPaths defaults to DefaultLegalPaths when not configured
+	LegalPaths []string
+
+	// DirectoryPath is set for directory sources
+	DirectoryPath string
+	// InlinePaths is set for inline sources (file path to contents)
+	InlinePaths map[string]string
+}
+
+// NewConfigFromYAML parses a single vendir Config document
+func NewConfigFromYAML(data []byte) (Config, error) {
+	docSet, err := yamlmeta.NewDocumentSetFromBytes(data, yamlmeta.DocSetOpts{WithoutMeta: true})
+	if err != nil {
+		return Config{}, fmt.Errorf("Parsing vendir config: %s", err)
+	}
+
+	var configObjs []map[string]interface{}
+
+	for _, doc := range docSet.Items {
+		if doc.IsEmpty() {
+			continue
+		}
+
+		unorderedDoc, err := util.UnorderedStringMaps(doc.AsInterface())
+		if err != nil {
+			return Config{}, fmt.Errorf("Parsing vendir config: %s", err)
+		}
+
+		obj, ok := unorderedDoc.(map[string]interface{})
+		if !ok {
+			return Config{}, fmt.Errorf("Expected vendir config document to be a map")
+		}
+
+		configObjs = append(configObjs, obj)
+	}
+
+	if len(configObjs) != 1 {
+		return Config{}, fmt.Errorf("Expected exactly one vendir config document, but found %d", len(configObjs))
+	}
+
+	obj := configObjs[0]
+
+	if obj["apiVersion"] != configAPIVersion || obj["kind"] != configKind {
+		return Config{}, fmt.Errorf("Expected vendir config to be apiVersion '%s' kind '%s', but was '%v' '%v'",
+			configAPIVersion, configKind, obj["apiVersion"], obj["kind"])
+	}
+
+	dirItems, err := sliceField(obj, "directories")
+	if err != nil {
+		return Config{}, err
+	}
+
+	var config Config
+
+	for _, dirItem := range dirItems {
+		dir, err := newDirectory(dirItem)
+		if err != nil {
+			return Config{}, err
+		}
+
+		config.Directories = append(config.Directories, dir)
+	}
+
+	return config, config.validate()
+}
+
+func newDirectory(val interface{}) (Directory, error) {
+	obj, ok := val.(map[string]interface{})
+	if !ok {
+		return Directory{}, fmt.Errorf("Expected vendir directory to be a map")
+	}
+
+	dir := Directory{}
+	dir.Path, _ = obj["path"].(string)
+
+	contentItems, err := sliceField(obj, "contents")
+	if err != nil {
+		return Directory{}, err
+	}
+
+	for _, contentItem := range contentItems {
+		content, err := newContent(contentItem)
+		if err != nil {
+			return Directory{}, fmt.Errorf("Directory '%s': %s", dir.Path, err)
+		}
+
+		dir.Contents = append(dir.Contents, content)
+	}
+
+	return dir, nil
+}
+
+func newContent(val interface{}) (Content, error) {
+	obj, ok := val.(map[string]interface{})
+	if !ok {
+		return Content{}, fmt.Errorf("Expected vendir content to be a map")
+	}
+
+	content := Content{}
+	content.Path, _ = obj["path"].(string)
+
+	for _, source := range unsupportedSources {
+		if _, found := obj[source]; found {
+			return Content{}, fmt.Errorf("Content '%s': Expected source to be one of %s, %s or %s, but was '%s'",
+				content.Path, SourceDirectory, SourceManual, SourceInline, source)
+		}
+	}
+
+	var err error
+
+	content.IncludePaths, err = stringSliceField(obj, "includePaths")
+	if err != nil {
+		return Content{}, err
+	}
+
+	content.ExcludePaths, err = stringSliceField(obj, "excludePaths")
+	if err != nil {
+		return Content{}, err
+	}
+
+	if _, found := obj["legalPaths"]; found {
+		content.LegalPaths, err = stringSliceField(obj, "legalPaths")
+		if err != nil {
+			return Content{}, err
+		}
+	} else {
+		content.LegalPaths = DefaultLegalPaths
+	}
+
+	var sources []string
+
+	if source, found := obj[SourceDirectory]; found {
+		sources = append(sources, SourceDirectory)
+
+		sourceObj, _ := source.(map[string]interface{})
+		content.DirectoryPath, _ = sourceObj["path"].(string)
+		if content.DirectoryPath == "" {
+			return Content{}, fmt.Errorf("Content '%s': Expected directory source to specify path", content.Path)
+		}
+	}
+
+	if _, found := obj[SourceManual]; found {
+		sources = append(sources, SourceManual)
+	}
+
+	if source, found := obj[SourceInline]; found {
+		sources = append(sources, SourceInline)
+
+		sourceObj, _ := source.(map[string]interface{})
+		if _, found := sourceObj["pathsFrom"]; found {
+			return Content{}, fmt.Errorf("Content '%s': Inline source pathsFrom is not supported as it requires cluster access", content.Path)
+		}
+
+		paths, _ := sourceObj["paths"].(map[string]interface{})
+
+		content.InlinePaths = map[string]string{}
+		for path, val := range paths {
+			typedVal, ok := val.(string)
+			if !ok {
+				return Content{}, fmt.Errorf("Content '%s': Expected inline path '%s' contents to be a string", content.Path, path)
+			}
+			content.InlinePaths[path] = typedVal
+		}
+	}
+
+	if len(sources) != 1 {
+		return Content{}, fmt.Errorf("Content '%s': Expected exactly one of %s, %s or %s sources, but found %d",
+			content.Path, SourceDirectory, SourceManual, SourceInline, len(sources))
+	}
+
+	content.Source = sources[0]
+
+	return content, nil
+}
+
+func (c Config) validate() error {
+	seenPaths := map[string]struct{}{}
+
+	for _, dir := range c.Directories {
+		err := validateRelativePath("directory", dir.Path)
+		if err != nil {
+			return err
+		}
+
+		for seenPath := range seenPaths {
+			if isParentOrSame(seenPath, dir.Path) || isParentOrSame(dir.Path, seenPath) {
+				return fmt.Errorf("Expected directory paths '%s' and '%s' to not overlap", seenPath, dir.Path)
+			}
+		}
+		seenPaths[dir.Path] = struct{}{}
+
+		for _, content := range dir.Contents {
+			err := validateRelativePath("content", content.Path)
+			if err != nil {
+				return fmt.Errorf("Directory '%s': %s", dir.Path, err)
+			}
+
+			for path := range content.InlinePaths {
+				err := validateRelativePath("inline file", path)
+				if err != nil {
+					return fmt.Errorf("Directory '%s': Content '%s': %s", dir.Path, content.Path, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+type lockDoc struct {
+	APIVersion  string             `yaml:"apiVersion"`
+	Kind        string             `yaml:"kind"`
+	Directories []lockDocDirectory `yaml:"directories"`
+}
+
+type lockDocDirectory struct {
+	Path     string           `yaml:"path"`
+	Contents []lockDocContent `yaml:"contents"`
+}
+
+type lockDocContent struct {
+	Path      string    `yaml:"path"`
+	Digest    string    `yaml:"digest"`
+	Directory *struct{} `yaml:"directory,omitempty"`
+	Manual    *struct{} `yaml:"manual,omitempty"`
+	Inline    *struct{} `yaml:"inline,omitempty"`
+}
+
+// LockYAML generates a vendir LockConfig document for the config.
+// Content digests (keyed by directory path, then content path) are
+// recorded in addition to vendir's fields.
+func (c Config) LockYAML(digests map[string]map[string]string) ([]byte, error) {
+	lock := lockDoc{
+		APIVersion:  configAPIVersion,
+		Kind:        lockConfigKind,
+		Directories: []lockDocDirectory{},
+	}
+
+	for _, dir := range c.Directories {
+		lockDir := lockDocDirectory{Path: dir.Path, Contents: []lockDocContent{}}
+
+		for _, content := range dir.Contents {
+			lockContent := lockDocContent{Path: content.Path, Digest: digests[dir.Path][content.Path]}
+
+			switch content.Source {
+			case SourceDirectory:
+				lockContent.Directory = &struct{}{}
+			case SourceManual:
+				lockContent.Manual = &struct{}{}
+			case SourceInline:
+				lockContent.Inline = &struct{}{}
+			}
+
+			lockDir.Contents = append(lockDir.Contents, lockContent)
+		}
+
+		lock.Directories = append(lock.Directories, lockDir)
+	}
+
+	lockBytes, err := yamlmeta.PlainMarshal(lock)
+	if err != nil {
+		return nil, fmt.Errorf("Generating vendir lock: %s", err)
+	}
+
+	return lockBytes, nil
+}
+
+func validateRelativePath(desc, path string) error {
+	cleanPath := filepath.Clean(filepath.FromSlash(path))
+
+	if path == "" || cleanPath == "." || filepath.IsAbs(cleanPath) ||
+		cleanPath == ".." || strings.HasPrefix(cleanPath, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("Expected %s path '%s' to be a non-empty relative path within its parent", desc, path)
+	}
+
+	return nil
+}
+
+func isParentOrSame(parent, child string) bool {
+	parent = filepath.Clean(filepath.FromSlash(parent))
+	child = filepath.Clean(filepath.FromSlash(child))
+
+	return parent == child || strings.HasPrefix(child, parent+string(filepath.Separator))
+}
+
+func sliceField(obj map[string]interface{}, key string) ([]interface{}, error) {
+	val, found := obj[key]
+	if !found || val == nil {
+		return nil, nil
+	}
+
+	items, ok := val.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Expected vendir config '%s' to be an array", key)
+	}
+
+	return items, nil
+}
+
+func stringSliceField(obj map[string]interface{}, key string) ([]string, error) {
+	items, err := sliceField(obj, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+
+	for _, item := range items {
+		typedItem, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("Expected vendir config '%s' to be an array of strings", key)
+		}
+		result = append(result, typedItem)
+	}
+
+	return result, nil
+}
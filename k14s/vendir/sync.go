@@ -0,0 +1,420 @@
+package vendir
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar"
+)
+
+const (
+	stagingDirPrefix = ".vendir-tmp-"
+)
+
+// DefaultLegalPaths are kept regardless of includePaths/excludePaths,
+// same as vendir
+var DefaultLegalPaths = []string{
+	"{LICENSE,LICENCE,License,Licence}{,.md,.txt,.rst}",
+	"{COPYRIGHT,Copyright}{,.md,.txt,.rst}",
+	"{NOTICE,Notice}{,.md,.txt,.rst}",
+}
+
+type SyncOpts struct {
+	// WorkingDir is where directories are synced to
+	WorkingDir string
+	// BaseDir is used to resolve relative directory source paths
+	BaseDir string
+}
+
+type SyncResult struct {
+	// Paths of synced contents in config order, joined to WorkingDir
+	// (relative paths stay relative)
+	Paths []string
+	// Lock is a vendir LockConfig that includes content digests
+	Lock []byte
+}
+
+// Sync assembles each directory in a staging location and then replaces
+// the existing directory, similar to vendir sync. Directories whose files
+// already match their sources are left untouched, so repeated syncs (e.g.
+// on every plan) do not rewrite them. Manual contents are taken from the
+// existing directory.
+func Sync(config Config, opts SyncOpts) (*SyncResult, error) {
+	err := os.MkdirAll(opts.WorkingDir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("Creating working directory: %s", err)
+	}
+
+	result := &SyncResult{}
+	digests := map[string]map[string]string{}
+
+	for _, dir := range config.Directories {
+		targetDir := filepath.Join(opts.WorkingDir, filepath.FromSlash(dir.Path))
+
+		contentDigests, err := syncDirectory(dir, targetDir, opts)
+		if err != nil {
+			return nil, fmt.Errorf("Syncing directory '%s': %s", dir.Path, err)
+		}
+
+		digests[dir.Path] = contentDigests
+
+		for _, content := range dir.Contents {
+			result.Paths = append(result.Paths, filepath.Join(targetDir, filepath.FromSlash(content.Path)))
+		}
+	}
+
+	result.Lock, err = config.LockYAML(digests)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// syncDirectory returns digests of each content
+func syncDirectory(dir Directory, targetDir string, opts SyncOpts) (map[string]string, error) {
+	expectedFiles := fileSet{}
+	contentDigests := map[string]string{}
+
+	for _, content := range dir.Contents {
+		files, err := contentFiles(content, targetDir, opts.BaseDir)
+		if err != nil {
+			return nil, fmt.Errorf("Content '%s': %s", content.Path, err)
+		}
+
+		contentDigests[content.Path] = files.Digest()
+
+		for path, file := range files {
+			expectedFiles[filepath.ToSlash(filepath.Join(filepath.FromSlash(content.Path), filepath.FromSlash(path)))] = file
+		}
+	}
+
+	if _, err := os.Stat(targetDir); err == nil {
+		existingFiles, err := dirFiles(targetDir, pathFilter{})
+		if err != nil {
+			return nil, err
+		}
+
+		if existingFiles.Digest() == expectedFiles.Digest() {
+			return contentDigests, nil
+		}
+	}
+
+	stagingDir, err := ioutil.TempDir(filepath.Dir(targetDir), stagingDirPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("Creating staging directory: %s", err)
+	}
+
+	defer os.RemoveAll(stagingDir)
+
+	for path, file := range expectedFiles {
+		err := file.WriteTo(filepath.Join(stagingDir, filepath.FromSlash(path)))
+		if err != nil {
+			return nil, fmt.Errorf("Writing '%s': %s", path, err)
+		}
+	}
+
+	err = os.RemoveAll(targetDir)
+	if err != nil {
+		return nil, fmt.Errorf("Deleting existing directory: %s", err)
+	}
+
+	err = os.Rename(stagingDir, targetDir)
+	if err != nil {
+		return nil, fmt.Errorf("Moving staging directory into place: %s", err)
+	}
+
+	return contentDigests, nil
+}
+
+// contentFiles lists files that a content contributes, without copying
+func contentFiles(content Content, targetDir, baseDir string) (fileSet, error) {
+	switch content.Source {
+	case SourceManual:
+		// Manual contents are not filtered, same as vendir
+		srcDir := filepath.Join(targetDir, filepath.FromSlash(content.Path))
+
+		if _, err := os.Stat(srcDir); err != nil {
+			return nil, fmt.Errorf("Expected manual content directory '%s' to exist: %s", srcDir, err)
+		}
+
+		return dirFiles(srcDir, pathFilter{})
+	}
+
+	filter := pathFilter{
+		includes: content.IncludePaths,
+		excludes: content.ExcludePaths,
+		legal:    content.LegalPaths,
+	}
+
+	var files fileSet
+
+	switch content.Source {
+	case SourceDirectory:
+		srcDir := content.DirectoryPath
+		if baseDir != "" && !filepath.IsAbs(srcDir) {
+			srcDir = filepath.Join(baseDir, srcDir)
+		}
+
+		srcInfo, err := os.Stat(srcDir)
+		if err != nil {
+			return nil, fmt.Errorf("Checking source directory: %s", err)
+		}
+
+		if !srcInfo.IsDir() {
+			return nil, fmt.Errorf("Expected source '%s' to be a directory", srcDir)
+		}
+
+		files, err = dirFiles(srcDir, filter)
+		if err != nil {
+			return nil, err
+		}
+
+	case SourceInline:
+		files = fileSet{}
+
+		for path, contents := range content.InlinePaths {
+			path = filepath.ToSlash(filepath.Clean(filepath.FromSlash(path)))
+
+			matched, err := filter.Matches(path)
+			if err != nil {
+				return nil, err
+			}
+
+			if matched {
+				files[path] = file{Contents: []byte(contents)}
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("Unknown content source '%s'", content.Source)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("Expected to find at least one file within directory")
+	}
+
+	return files, nil
+}
+
+// file is either a regular file or a symlink
+type file struct {
+	SrcPath    string
+	Contents   []byte
+	Mode       os.FileMode
+	LinkTarget string
+	IsLink     bool
+}
+
+func (f file) Digest() (string, error) {
+	if f.IsLink {
+		return "link:" + f.LinkTarget, nil
+	}
+
+	hash := sha256.New()
+
+	if f.SrcPath == "" {
+		hash.Write(f.Contents)
+	} else {
+		srcFile, err := os.Open(f.SrcPath)
+		if err != nil {
+			return "", err
+		}
+
+		defer srcFile.Close()
+
+		_, err = io.Copy(hash, srcFile)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "file:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (f file) WriteTo(dstPath string) error {
+	err := os.MkdirAll(filepath.Dir(dstPath), 0700)
+	if err != nil {
+		return err
+	}
+
+	if f.IsLink {
+		return os.Symlink(f.LinkTarget, dstPath)
+	}
+
+	mode := f.Mode
+	if mode == 0 {
+		mode = 0600
+	}
+
+	if f.SrcPath == "" {
+		return ioutil.WriteFile(dstPath, f.Contents, mode)
+	}
+
+	return copyFile(f.SrcPath, dstPath, mode)
+}
+
+// fileSet maps slash separated relative paths to files
+type fileSet map[string]file
+
+// Digest covers paths, file contents and symlink targets. Permissions
+// are not included as they depend on umask.
+func (s fileSet) Digest() string {
+	var paths []string
+	for path := range s {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	hash := sha256.New()
+
+	for _, path := range paths {
+		fileDigest, err := s[path].Digest()
+		if err != nil {
+			// Unreadable files never match, which forces a sync that reports the error
+			fileDigest = "error:" + err.Error()
+		}
+		fmt.Fprintf(hash, "%s\x00%s\n", path, fileDigest)
+	}
+
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil))
+}
+
+func dirFiles(srcDir string, filter pathFilter) (fileSet, error) {
+	files := fileSet{}
+
+	err := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+
+		// Staging directories of interrupted syncs are not content
+		if strings.HasPrefix(relPath, stagingDirPrefix) {
+			return nil
+		}
+
+		matched, err := filter.Matches(filepath.ToSlash(relPath))
+		if err != nil {
+			return err
+		}
+
+		if !matched {
+			return nil
+		}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			linkTarget, err := os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf("Reading symlink '%s': %s", relPath, err)
+			}
+			files[filepath.ToSlash(relPath)] = file{LinkTarget: linkTarget, IsLink: true}
+
+		case info.Mode().IsRegular():
+			files[filepath.ToSlash(relPath)] = file{SrcPath: path, Mode: info.Mode().Perm()}
+
+		default:
+			return fmt.Errorf("Expected '%s' to be a regular file, directory or symlink", relPath)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+func copyFile(srcPath, dstPath string, mode os.FileMode) error {
+	srcFile, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("Opening file: %s", err)
+	}
+
+	defer srcFile.Close()
+
+	dstFile, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return fmt.Errorf("Creating file: %s", err)
+	}
+
+	_, err = io.Copy(dstFile, srcFile)
+	closeErr := dstFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Copying file '%s': %s", srcPath, err)
+	}
+
+	return nil
+}
+
+// pathFilter applies includePaths, excludePaths and legalPaths with
+// doublestar globs, same as vendir's file filter: legal paths are always
+// kept, excludes win over includes
+type pathFilter struct {
+	includes []string
+	excludes []string
+	legal    []string
+}
+
+func (f pathFilter) Matches(path string) (bool, error) {
+	matched := len(f.includes) == 0
+
+	ok, err := matchesAny(f.includes, path)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		matched = true
+	}
+
+	ok, err = matchesAny(f.excludes, path)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		matched = false
+	}
+
+	ok, err = matchesAny(f.legal, path)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		matched = true
+	}
+
+	return matched, nil
+}
+
+func matchesAny(patterns []string, path string) (bool, error) {
+	for _, pattern := range patterns {
+		ok, err := doublestar.Match(pattern, path)
+		if err != nil {
+			return false, fmt.Errorf("Matching path glob '%s': %s", pattern, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,377 @@
+package vendir
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "vendir-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for path, contents := range files {
+		fullPath := filepath.Join(dir, filepath.FromSlash(path))
+
+		err := os.MkdirAll(filepath.Dir(fullPath), 0700)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ioutil.WriteFile(fullPath, []byte(contents), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var result []string
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			relPath, _ := filepath.Rel(dir, path)
+			result = append(result, filepath.ToSlash(relPath))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+func syncYAML(t *testing.T, yaml string, opts SyncOpts) (*SyncResult, error) {
+	t.Helper()
+
+	config, err := NewConfigFromYAML([]byte(yaml))
+	if err != nil {
+		t.Fatalf("Expected config to parse: %s", err)
+	}
+
+	return Sync(config, opts)
+}
+
+func TestSyncDirectoryFilters(t *testing.T) {
+	srcDir := tempDir(t)
+	defer os.RemoveAll(srcDir)
+
+	workingDir := tempDir(t)
+	defer os.RemoveAll(workingDir)
+
+	writeFiles(t, srcDir, map[string]string{
+		"LICENSE":                "license",
+		"README.md":              "readme",
+		"config/app.yml":         "app",
+		"config/nested/db.yml":   "db",
+		"config/nested/db_test":  "test",
+		"config/nested/skip.yml": "skip",
+	})
+
+	_, err := syncYAML(t, `
+apiVersion: vendir.k14s.io/v1alpha1
+kind: Config
+directories:
+- path: vendor
+  contents:
+  - path: src
+    directory:
+      path: missing
+`, SyncOpts{WorkingDir: workingDir, BaseDir: srcDir})
+	if err == nil || !strings.Contains(err.Error(), "Checking source directory") {
+		t.Fatalf("Expected missing source directory to fail, but was: %v", err)
+	}
+
+	result, err := syncYAML(t, `
+apiVersion: vendir.k14s.io/v1alpha1
+kind: Config
+directories:
+- path: vendor
+  contents:
+  - path: src
+    directory:
+      path: `+filepath.Base(srcDir)+`
+    includePaths:
+    - config/**/*.yml
+    excludePaths:
+    - config/nested/skip.yml
+`, SyncOpts{WorkingDir: workingDir, BaseDir: filepath.Dir(srcDir)})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	expectedPath := filepath.Join(workingDir, "vendor", "src")
+	if len(result.Paths) != 1 || result.Paths[0] != expectedPath {
+		t.Fatalf("Expected paths to be ['%s'], but was %#v", expectedPath, result.Paths)
+	}
+
+	// Legal files are kept even though they are not included
+	expectedFiles := []string{"LICENSE", "config/app.yml", "config/nested/db.yml"}
+
+	files := listFiles(t, expectedPath)
+	if strings.Join(files, ",") != strings.Join(expectedFiles, ",") {
+		t.Fatalf("Expected files %v, but was %v", expectedFiles, files)
+	}
+}
+
+func TestSyncLegalPathsOverride(t *testing.T) {
+	workingDir := tempDir(t)
+	defer os.RemoveAll(workingDir)
+
+	_, err := syncYAML(t, `
+apiVersion: vendir.k14s.io/v1alpha1
+kind: Config
+directories:
+- path: vendor
+  contents:
+  - path: inline
+    inline:
+      paths:
+        LICENSE: license
+        app.yml: app
+    excludePaths:
+    - "*"
+    legalPaths: []
+`, SyncOpts{WorkingDir: workingDir})
+	if err == nil || !strings.Contains(err.Error(), "Expected to find at least one file") {
+		t.Fatalf("Expected content without files to fail, but was: %v", err)
+	}
+}
+
+func TestSyncInlineAndManual(t *testing.T) {
+	workingDir := tempDir(t)
+	defer os.RemoveAll(workingDir)
+
+	config := `
+apiVersion: vendir.k14s.io/v1alpha1
+kind: Config
+directories:
+- path: vendor
+  contents:
+  - path: inline
+    inline:
+      paths:
+        a.yml: a
+        nested/b.yml: b
+  - path: local
+    manual: {}
+`
+
+	_, err := syncYAML(t, config, SyncOpts{WorkingDir: workingDir})
+	if err == nil || !strings.Contains(err.Error(), "Expected manual content directory") {
+		t.Fatalf("Expected missing manual content to fail, but was: %v", err)
+	}
+
+	writeFiles(t, workingDir, map[string]string{
+		"vendor/local/edited.yml": "edited",
+		"vendor/stale.yml":        "stale",
+	})
+
+	result, err := syncYAML(t, config, SyncOpts{WorkingDir: workingDir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	expectedFiles := []string{"inline/a.yml", "inline/nested/b.yml", "local/edited.yml"}
+
+	files := listFiles(t, filepath.Join(workingDir, "vendor"))
+	if strings.Join(files, ",") != strings.Join(expectedFiles, ",") {
+		t.Fatalf("Expected files %v, but was %v", expectedFiles, files)
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(workingDir, "vendor", "inline", "nested", "b.yml"))
+	if err != nil || string(contents) != "b" {
+		t.Fatalf("Expected inline contents to be written, but was '%s' (%v)", contents, err)
+	}
+
+	if len(result.Paths) != 2 {
+		t.Fatalf("Expected path per content, but was %#v", result.Paths)
+	}
+}
+
+func TestSyncSkipsUpToDateDirectories(t *testing.T) {
+	workingDir := tempDir(t)
+	defer os.RemoveAll(workingDir)
+
+	config := `
+apiVersion: vendir.k14s.io/v1alpha1
+kind: Config
+directories:
+- path: vendor
+  contents:
+  - path: inline
+    inline:
+      paths:
+        a.yml: a
+`
+
+	firstResult, err := syncYAML(t, config, SyncOpts{WorkingDir: workingDir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	filePath := filepath.Join(workingDir, "vendor", "inline", "a.yml")
+	pastTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	err = os.Chtimes(filePath, pastTime, pastTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secondResult, err := syncYAML(t, config, SyncOpts{WorkingDir: workingDir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(pastTime) {
+		t.Fatalf("Expected up to date directory to not be rewritten")
+	}
+
+	if string(firstResult.Lock) != string(secondResult.Lock) {
+		t.Fatalf("Expected lock to be stable, but was:\n%s\n%s", firstResult.Lock, secondResult.Lock)
+	}
+
+	// Local modifications are reverted
+	writeFiles(t, workingDir, map[string]string{"vendor/inline/a.yml": "modified"})
+
+	_, err = syncYAML(t, config, SyncOpts{WorkingDir: workingDir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(filePath)
+	if err != nil || string(contents) != "a" {
+		t.Fatalf("Expected modified file to be synced, but was '%s' (%v)", contents, err)
+	}
+}
+
+func TestSyncLockDigests(t *testing.T) {
+	workingDir := tempDir(t)
+	defer os.RemoveAll(workingDir)
+
+	configTpl := `
+apiVersion: vendir.k14s.io/v1alpha1
+kind: Config
+directories:
+- path: vendor
+  contents:
+  - path: inline
+    inline:
+      paths:
+        a.yml: CONTENTS
+`
+
+	first, err := syncYAML(t, strings.Replace(configTpl, "CONTENTS", "a", 1), SyncOpts{WorkingDir: workingDir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	second, err := syncYAML(t, strings.Replace(configTpl, "CONTENTS", "b", 1), SyncOpts{WorkingDir: workingDir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	for _, lock := range []string{string(first.Lock), string(second.Lock)} {
+		if !strings.Contains(lock, "kind: LockConfig") || !strings.Contains(lock, "digest: sha256:") {
+			t.Fatalf("Expected lock to include content digest, but was: %s", lock)
+		}
+	}
+
+	if string(first.Lock) == string(second.Lock) {
+		t.Fatalf("Expected lock digest to change with contents")
+	}
+}
+
+func TestNewConfigFromYAMLErrors(t *testing.T) {
+	cases := map[string]string{
+		"network source": `
+apiVersion: vendir.k14s.io/v1alpha1
+kind: Config
+directories:
+- path: vendor
+  contents:
+  - path: repo
+    git:
+      url: https://example.com/repo
+`,
+		"overlapping directories": `
+apiVersion: vendir.k14s.io/v1alpha1
+kind: Config
+directories:
+- path: vendor
+  contents:
+  - path: a
+    manual: {}
+- path: vendor/nested
+  contents:
+  - path: b
+    manual: {}
+`,
+		"parent directory path": `
+apiVersion: vendir.k14s.io/v1alpha1
+kind: Config
+directories:
+- path: ../vendor
+  contents:
+  - path: a
+    manual: {}
+`,
+		"multiple sources": `
+apiVersion: vendir.k14s.io/v1alpha1
+kind: Config
+directories:
+- path: vendor
+  contents:
+  - path: a
+    manual: {}
+    inline: {}
+`,
+		"non-string key": `
+apiVersion: vendir.k14s.io/v1alpha1
+kind: Config
+directories:
+- path: vendor
+  contents:
+  - path: a
+    manual: {}
+    1: ignored
+`,
+		"wrong kind": `
+apiVersion: vendir.k14s.io/v1alpha1
+kind: LockConfig
+`,
+	}
+
+	for desc, yaml := range cases {
+		_, err := NewConfigFromYAML([]byte(yaml))
+		if err == nil {
+			t.Fatalf("Expected config with %s to fail", desc)
+		}
+	}
+}
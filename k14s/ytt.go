@@ -0,0 +1,986 @@
+package k14s
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/validation"
+	cmdcore "github.com/k14s/ytt/pkg/cmd/core"
+	"github.com/k14s/ytt/pkg/cmd/template"
+	filespkg "github.com/k14s/ytt/pkg/files"
+	"github.com/k14s/ytt/pkg/orderedmap"
+	"github.com/k14s/ytt/pkg/workspace"
+	"github.com/k14s/ytt/pkg/yamlmeta"
+	util "github.com/niallthomson/terraform-provider-k14s/k14s/util"
+	"github.com/spf13/cobra"
+)
+
+const (
+	yttOutputFormatYAML          = "yaml"
+	yttOutputFormatJSON          = "json"
+	yttOutputFormatJSONDocuments = "json_documents"
+)
+
+// yttResourceGetter is satisfied by both *schema.ResourceData and
+// *schema.ResourceDiff so templates can be rendered during plan
+type yttResourceGetter interface {
+	Get(key string) interface{}
+}
+
+// yttSchema returns the inputs and rendered outputs shared by
+// k14sx_ytt and k14sx_ytt_template
+func yttSchema() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"config_yaml": {
+			Type:        schema.TypeList,
+			Description: "List of inline configuration yaml",
+			Optional:    true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+		},
+		"file": yttFileSchema(),
+		"files": {
+			Type:        schema.TypeList,
+			Description: "List of configuration files, directories, glob patterns or HTTP(S) URLs optionally pinned with a #sha256=<hex> suffix (optionally prefixed with 'relative/path=')",
+			Optional:    true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+		},
+		"file_marks": {
+			Type:        schema.TypeList,
+			Description: "File marks, as accepted by ytt's --file-mark (format: path:key=value, e.g. config/*.txt:type=data)",
+			Optional:    true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+		},
+		"library": {
+			Type:        schema.TypeList,
+			Description: "Private library under _ytt_lib/<name>. Templates get it with its data values applied by loading library from /k14sx-library.star in place of @ytt:library",
+			Optional:    true,
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"name": {
+						Type:        schema.TypeString,
+						Description: "Name of the library (e.g. github.com/org/lib)",
+						Required:    true,
+					},
+					"path": {
+						Type:        schema.TypeString,
+						Description: "Directory containing the library files, resolved against base_dir",
+						Optional:    true,
+					},
+					"file": yttFileSchema(),
+					"values": {
+						Type:        schema.TypeMap,
+						Description: "Library data values, as strings (format: all.key1.subkey = value), passed with library.with_data_values",
+						Optional:    true,
+						Elem: &schema.Schema{
+							Type: schema.TypeString,
+						},
+					},
+					"values_yaml": {
+						Type:        schema.TypeString,
+						Description: "Library data values YAML document, passed with library.with_data_values after values",
+						Optional:    true,
+					},
+				},
+			},
+		},
+		"base_dir": {
+			Type:        schema.TypeString,
+			Description: "Directory that relative files are resolved against (e.g. path.module), defaults to the working directory",
+			Optional:    true,
+		},
+		"values": {
+			Type:        schema.TypeMap,
+			Description: "Data values, as strings (format: all.key1.subkey = value)",
+			Optional:    true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+		},
+		"values_yaml": {
+			Type:        schema.TypeMap,
+			Description: "Data values, parsed as YAML (format: all.key1.subkey = yaml)",
+			Optional:    true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+		},
+		"values_files": {
+			Type:        schema.TypeMap,
+			Description: "Data values, set to file contents as strings (format: all.key1.subkey = /file/path). Relative paths are resolved against base_dir",
+			Optional:    true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+		},
+		"values_env_prefix": {
+			Type:        schema.TypeList,
+			Description: "Extract data values (as strings) from prefixed environment variables of the provider process (format: PREFIX for PREFIX_all__key1=str)",
+			Optional:    true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+		},
+		"values_env_yaml_prefix": {
+			Type:        schema.TypeList,
+			Description: "Extract data values (parsed as YAML) from prefixed environment variables of the provider process (format: PREFIX for PREFIX_all__key1=true)",
+			Optional:    true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+		},
+		"ignore_unknown_comments": {
+			Type:        schema.TypeBool,
+			Description: "Ignore comments that do not start with '#@' or '#!'",
+			Optional:    true,
+			Default:     true,
+		},
+		"strict": {
+			Type:        schema.TypeBool,
+			Description: "Use the strict YAML subset for templates and data values",
+			Optional:    true,
+			Default:     false,
+		},
+		"output_format": {
+			Type:         schema.TypeString,
+			Description:  "Format of result: yaml (document stream), json (array of documents) or json_documents (one JSON document per line)",
+			Optional:     true,
+			Default:      yttOutputFormatYAML,
+			ValidateFunc: validation.StringInSlice([]string{yttOutputFormatYAML, yttOutputFormatJSON, yttOutputFormatJSONDocuments}, false),
+		},
+		"result": {
+			Type:        schema.TypeString,
+			Description: "Rendered output in the requested output_format",
+			Computed:    true,
+			Sensitive:   true,
+		},
+		"sensitive_kinds": {
+			Type:        schema.TypeList,
+			Description: "Additional kinds of documents to treat as sensitive (Secret is always sensitive)",
+			Optional:    true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+		},
+		"sensitive_match": {
+			Type:        schema.TypeList,
+			Description: "Documents matching all given fields are treated as sensitive",
+			Optional:    true,
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"api_version": {
+						Type:     schema.TypeString,
+						Optional: true,
+					},
+					"kind": {
+						Type:     schema.TypeString,
+						Optional: true,
+					},
+					"name": {
+						Type:     schema.TypeString,
+						Optional: true,
+					},
+					"namespace": {
+						Type:     schema.TypeString,
+						Optional: true,
+					},
+				},
+			},
+		},
+		"result_sensitive": {
+			Type:        schema.TypeString,
+			Description: "Rendered output of sensitive documents only",
+			Computed:    true,
+			Sensitive:   true,
+		},
+		"result_nonsensitive": {
+			Type:        schema.TypeString,
+			Description: "Rendered output of non-sensitive documents only, shown in plan",
+			Computed:    true,
+		},
+		"documents": {
+			Type:        schema.TypeList,
+			Description: "Rendered yaml documents",
+			Computed:    true,
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"api_version": {
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+					"kind": {
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+					"name": {
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+					"namespace": {
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+					"yaml": {
+						Type:      schema.TypeString,
+						Computed:  true,
+						Sensitive: true,
+					},
+					"json": {
+						Type:      schema.TypeString,
+						Computed:  true,
+						Sensitive: true,
+					},
+					"sensitive": {
+						Type:     schema.TypeBool,
+						Computed: true,
+					},
+				},
+			},
+		},
+		"output_files": {
+			Type:        schema.TypeMap,
+			Description: "Rendered output files keyed by relative path",
+			Computed:    true,
+			Sensitive:   true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+		},
+		"data_values": {
+			Type:        schema.TypeString,
+			Description: "Final data values after all overlays, as YAML. Sensitive as values may come from env vars or files",
+			Computed:    true,
+			Sensitive:   true,
+		},
+		"data_values_json": {
+			Type:        schema.TypeString,
+			Description: "Final data values after all overlays, as JSON. Sensitive as values may come from env vars or files",
+			Computed:    true,
+			Sensitive:   true,
+		},
+		"data_values_nonsensitive": {
+			Type:        schema.TypeString,
+			Description: "Final data values after all overlays, as YAML, shown in plan. Blank when values_env_prefix, values_env_yaml_prefix or values_files are used",
+			Computed:    true,
+		},
+		"data_values_defaults": {
+			Type:        schema.TypeString,
+			Description: "Data values declared by the templates, as YAML, before values, env vars and values files are applied. These are the data values the templates accept",
+			Computed:    true,
+		},
+	}
+}
+
+// yttInputSchema returns only the inputs of yttSchema, without excludedKeys,
+// so that templates can be rendered from a block within other resources
+func yttInputSchema(excludedKeys ...string) map[string]*schema.Schema {
+	inputSchema := map[string]*schema.Schema{}
+
+	for key, keySchema := range yttSchema() {
+		if keySchema.Computed && !keySchema.Optional {
+			continue
+		}
+		inputSchema[key] = keySchema
+	}
+
+	for _, key := range excludedKeys {
+		delete(inputSchema, key)
+	}
+
+	return inputSchema
+}
+
+// yttBlockGetter reads inputs from a nested block built with yttInputSchema.
+// Inputs excluded from the block fall back to their defaults.
+type yttBlockGetter map[string]interface{}
+
+func (g yttBlockGetter) Get(key string) interface{} {
+	if val, found := g[key]; found && val != nil {
+		return val
+	}
+
+	keySchema, found := yttSchema()[key]
+	if !found {
+		panic(fmt.Sprintf("Unknown ytt input '%s'", key))
+	}
+
+	if keySchema.Default != nil {
+		return keySchema.Default
+	}
+
+	switch keySchema.Type {
+	case schema.TypeList:
+		return []interface{}{}
+	case schema.TypeMap:
+		return map[string]interface{}{}
+	case schema.TypeBool:
+		return false
+	default:
+		return ""
+	}
+}
+
+// yttOutputKeys lists attributes populated from a yttRenderResult
+var yttOutputKeys = []string{"result", "result_sensitive", "result_nonsensitive", "documents", "output_files",
+	"data_values", "data_values_json", "data_values_nonsensitive", "data_values_defaults"}
+
+type yttRenderResult struct {
+	InputHash string
+	// Summary describes rendered documents without their contents
+	Summary    string
+	Attributes map[string]interface{}
+}
+
+func yttRender(d yttResourceGetter, fetcher *util.HTTPFetcher) (*yttRenderResult, error) {
+	ui := cmdcore.NewPlainUI(false)
+
+	var filePaths []string
+
+	filesParam := d.Get("files").([]interface{})
+	if len(filesParam) > 0 {
+
+		for _, fileParam := range filesParam {
+			filePaths = append(filePaths, fileParam.(string))
+		}
+	}
+
+	filePaths, err := yttResolvePaths(d.Get("base_dir").(string), filePaths, fetcher)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := filespkg.NewSortedFilesFromPaths(filePaths, filespkg.SymlinkAllowOpts{
+		AllowAll:        true,
+		AllowedDstPaths: nil,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Loading files: %s", err)
+	}
+
+	var inlineFiles []*filespkg.File
+
+	configParam := d.Get("config_yaml").([]interface{})
+	if len(configParam) > 0 {
+
+		for _, configParam := range configParam {
+			inlineFile, err := filespkg.NewFileFromSource(filespkg.NewCachedSource(filespkg.NewBytesSource("inline.yml", []byte(configParam.(string)))))
+			if err != nil {
+				return nil, err
+			}
+
+			inlineFiles = append(inlineFiles, inlineFile)
+		}
+	}
+
+	namedFiles, err := yttInlineFiles(d.Get("file").([]interface{}), "")
+	if err != nil {
+		return nil, err
+	}
+
+	inlineFiles = append(inlineFiles, namedFiles...)
+
+	libraryFiles, err := yttLibraryFiles(d.Get("library").([]interface{}), d.Get("base_dir").(string), fetcher)
+	if err != nil {
+		return nil, err
+	}
+
+	inlineFiles = append(inlineFiles, libraryFiles...)
+
+	files = filespkg.NewSortedFiles(append(files, inlineFiles...))
+
+	files, err = yttApplyFileMarks(files, d.Get("file_marks").([]interface{}))
+	if err != nil {
+		return nil, err
+	}
+
+	rootLibrary := workspace.NewRootLibrary(files)
+	rootLibrary.Print(ui.DebugWriter())
+
+	strict := d.Get("strict").(bool)
+
+	libraryExecutionFactory := workspace.NewLibraryExecutionFactory(ui, workspace.TemplateLoaderOpts{
+		IgnoreUnknownComments: d.Get("ignore_unknown_comments").(bool),
+		StrictYAML:            strict,
+	})
+
+	libraryCtx := workspace.LibraryExecutionContext{Current: rootLibrary, Root: rootLibrary}
+	libraryLoader := libraryExecutionFactory.New(libraryCtx)
+
+	valuesFiles, err := yttValuesFiles(d, d.Get("base_dir").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	dvFlags := template.DataValuesFlags{
+		EnvFromStrings: expandStringSlice(d.Get("values_env_prefix").([]interface{})),
+		EnvFromYAML:    expandStringSlice(d.Get("values_env_yaml_prefix").([]interface{})),
+		KVsFromStrings: yttKVs(d, "values"),
+		KVsFromYAML:    yttKVs(d, "values_yaml"),
+		KVsFromFiles:   valuesFiles,
+	}
+
+	valuesOverlays, err := dvFlags.AsOverlays(strict)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := libraryLoader.Values(valuesOverlays)
+	if err != nil {
+		return nil, err
+	}
+
+	dataValuesYAML, dataValuesJSON, err := yttDataValues(values)
+	if err != nil {
+		return nil, err
+	}
+
+	// Values coming from config are already shown in plan
+	dataValuesNonSensitive := ""
+	if len(dvFlags.EnvFromStrings) == 0 && len(dvFlags.EnvFromYAML) == 0 && len(dvFlags.KVsFromFiles) == 0 {
+		dataValuesNonSensitive = dataValuesYAML
+	}
+
+	defaultValues, err := libraryLoader.Values(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	dataValuesDefaults, _, err := yttDataValues(defaultValues)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := libraryLoader.Eval(values)
+	if err != nil {
+		return nil, err
+	}
+
+	outputFormat := d.Get("output_format").(string)
+	sensitivity := newYttSensitivity(d)
+
+	resultBytes, err := yttFormatDocSet(result.DocSet, outputFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	sensitiveDocSet, nonSensitiveDocSet := sensitivity.Partition(result.DocSet)
+
+	sensitiveBytes, err := yttFormatDocSet(sensitiveDocSet, outputFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	nonSensitiveBytes, err := yttFormatDocSet(nonSensitiveDocSet, outputFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	documents, err := yttDocuments(result.DocSet, sensitivity)
+	if err != nil {
+		return nil, err
+	}
+
+	outputFiles := map[string]interface{}{}
+	for _, outputFile := range result.Files {
+		outputFiles[outputFile.RelativePath()] = string(outputFile.Bytes())
+	}
+
+	inputHash, err := yttInputHash(files, valuesOverlays, d)
+	if err != nil {
+		return nil, err
+	}
+
+	return &yttRenderResult{
+		InputHash: inputHash,
+		Summary:   yttSummary(documents),
+		Attributes: map[string]interface{}{
+			"result":                   string(resultBytes),
+			"result_sensitive":         string(sensitiveBytes),
+			"result_nonsensitive":      string(nonSensitiveBytes),
+			"documents":                documents,
+			"output_files":             outputFiles,
+			"data_values":              dataValuesYAML,
+			"data_values_json":         dataValuesJSON,
+			"data_values_nonsensitive": dataValuesNonSensitive,
+			"data_values_defaults":     dataValuesDefaults,
+		},
+	}, nil
+}
+
+// yttInputHash covers everything that affects rendering: file paths and
+// contents (after marks), final data values overlays and output options
+func yttInputHash(files []*filespkg.File, valuesOverlays []*yamlmeta.Document, d yttResourceGetter) (string, error) {
+	hash := sha256.New()
+
+	for _, file := range files {
+		fileBytes, err := file.Bytes()
+		if err != nil {
+			return "", fmt.Errorf("Reading file '%s': %s", file.RelativePath(), err)
+		}
+
+		fmt.Fprintf(hash, "file:%s:%d:%d:%t\n", file.RelativePath(), file.Type(), len(fileBytes), file.IsTemplate())
+		hash.Write(fileBytes)
+	}
+
+	for _, valuesOverlay := range valuesOverlays {
+		valuesBytes, err := valuesOverlay.AsYAMLBytes()
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(hash, "values:%d\n", len(valuesBytes))
+		hash.Write(valuesBytes)
+	}
+
+	opts, err := json.Marshal([]interface{}{
+		d.Get("strict"), d.Get("ignore_unknown_comments"), d.Get("output_format"),
+		d.Get("sensitive_kinds"), d.Get("sensitive_match"),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(hash, "opts:%s\n", opts)
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func yttDocuments(docSet *yamlmeta.DocumentSet, sensitivity yttSensitivity) ([]interface{}, error) {
+	var documents []interface{}
+
+	for _, doc := range docSet.Items {
+		if doc.IsEmpty() {
+			continue
+		}
+
+		docBytes, err := doc.AsYAMLBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		unorderedDoc := yttUnorderedValue(doc.AsInterface())
+
+		docJSON, err := json.Marshal(unorderedDoc)
+		if err != nil {
+			return nil, fmt.Errorf("Marshaling document as JSON: %s", err)
+		}
+
+		ref := newYttDocumentRef(unorderedDoc)
+
+		documents = append(documents, map[string]interface{}{
+			"api_version": ref.APIVersion,
+			"kind":        ref.Kind,
+			"name":        ref.Name,
+			"namespace":   ref.Namespace,
+			"yaml":        string(docBytes),
+			"json":        string(docJSON),
+			"sensitive":   sensitivity.IsSensitive(ref),
+		})
+	}
+
+	return documents, nil
+}
+
+// yttSummary counts documents by kind (e.g. "3 documents (ConfigMap: 1, Deployment: 2)")
+func yttSummary(documents []interface{}) string {
+	kindCounts := map[string]int{}
+
+	for _, document := range documents {
+		kind := document.(map[string]interface{})["kind"].(string)
+		if kind == "" {
+			kind = "<unknown>"
+		}
+		kindCounts[kind]++
+	}
+
+	var kinds []string
+	for kind := range kindCounts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	var kindDescs []string
+	for _, kind := range kinds {
+		kindDescs = append(kindDescs, fmt.Sprintf("%s: %d", kind, kindCounts[kind]))
+	}
+
+	summary := fmt.Sprintf("%d documents", len(documents))
+	if len(kindDescs) > 0 {
+		summary += " (" + strings.Join(kindDescs, ", ") + ")"
+	}
+
+	return summary
+}
+
+func yttDataValues(values *yamlmeta.Document) (string, string, error) {
+	if values == nil || values.Value == nil {
+		return "{}\n", "{}", nil
+	}
+
+	valuesYAML, err := values.AsYAMLBytes()
+	if err != nil {
+		return "", "", fmt.Errorf("Marshaling data values: %s", err)
+	}
+
+	valuesJSON, err := json.Marshal(yttUnorderedValue(values.AsInterface()))
+	if err != nil {
+		return "", "", fmt.Errorf("Marshaling data values as JSON: %s", err)
+	}
+
+	return string(valuesYAML), string(valuesJSON), nil
+}
+
+func yttFormatDocSet(docSet *yamlmeta.DocumentSet, format string) ([]byte, error) {
+	switch format {
+	case yttOutputFormatJSON:
+		items := []interface{}{}
+		for _, doc := range docSet.Items {
+			if !doc.IsEmpty() {
+				items = append(items, yttUnorderedValue(doc.AsInterface()))
+			}
+		}
+
+		resultBytes, err := json.Marshal(items)
+		if err != nil {
+			return nil, fmt.Errorf("Marshaling documents as JSON: %s", err)
+		}
+		return resultBytes, nil
+
+	case yttOutputFormatJSONDocuments:
+		var buf bytes.Buffer
+		for _, doc := range docSet.Items {
+			if doc.IsEmpty() {
+				continue
+			}
+
+			docBytes, err := json.Marshal(yttUnorderedValue(doc.AsInterface()))
+			if err != nil {
+				return nil, fmt.Errorf("Marshaling document as JSON: %s", err)
+			}
+			buf.Write(docBytes)
+			buf.WriteString("\n")
+		}
+		return buf.Bytes(), nil
+
+	default:
+		return docSet.AsBytes()
+	}
+}
+
+// yttUnorderedValue converts ytt ordered maps into plain maps with string
+// keys. Unlike orderedmap.Conversion it does not panic on non-string keys
+// (e.g. YAML booleans), instead formatting them as strings like other
+// YAML to JSON converters do. encoding/json sorts map keys, which keeps
+// JSON output stable.
+func yttUnorderedValue(val interface{}) interface{} {
+	switch typedVal := val.(type) {
+	case *orderedmap.Map:
+		result := map[string]interface{}{}
+		typedVal.Iterate(func(k, v interface{}) {
+			result[fmt.Sprintf("%v", k)] = yttUnorderedValue(v)
+		})
+		return result
+
+	case []interface{}:
+		result := make([]interface{}, len(typedVal))
+		for i, item := range typedVal {
+			result[i] = yttUnorderedValue(item)
+		}
+		return result
+
+	default:
+		return val
+	}
+}
+
+type yttDocumentRef struct {
+	APIVersion string
+	Kind       string
+	Name       string
+	Namespace  string
+}
+
+// newYttDocumentRef expects a document value converted via yttUnorderedValue
+func newYttDocumentRef(unorderedDoc interface{}) yttDocumentRef {
+	ref := yttDocumentRef{}
+
+	if obj, ok := unorderedDoc.(map[string]interface{}); ok {
+		ref.APIVersion = yttStringField(obj, "apiVersion")
+		ref.Kind = yttStringField(obj, "kind")
+
+		if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+			ref.Name = yttStringField(metadata, "name")
+			ref.Namespace = yttStringField(metadata, "namespace")
+		}
+	}
+
+	return ref
+}
+
+// Matches treats empty fields of the receiver as wildcards
+func (r yttDocumentRef) Matches(other yttDocumentRef) bool {
+	return (r.APIVersion == "" || r.APIVersion == other.APIVersion) &&
+		(r.Kind == "" || r.Kind == other.Kind) &&
+		(r.Name == "" || r.Name == other.Name) &&
+		(r.Namespace == "" || r.Namespace == other.Namespace)
+}
+
+type yttSensitivity struct {
+	matches []yttDocumentRef
+}
+
+func newYttSensitivity(d yttResourceGetter) yttSensitivity {
+	sensitivity := yttSensitivity{
+		matches: []yttDocumentRef{{Kind: "Secret"}},
+	}
+
+	for _, kind := range d.Get("sensitive_kinds").([]interface{}) {
+		sensitivity.matches = append(sensitivity.matches, yttDocumentRef{Kind: kind.(string)})
+	}
+
+	for _, matchParam := range d.Get("sensitive_match").([]interface{}) {
+		match, ok := matchParam.(map[string]interface{})
+		if !ok {
+			// Empty block matches everything
+			match = map[string]interface{}{}
+		}
+
+		sensitivity.matches = append(sensitivity.matches, yttDocumentRef{
+			APIVersion: yttStringField(match, "api_version"),
+			Kind:       yttStringField(match, "kind"),
+			Name:       yttStringField(match, "name"),
+			Namespace:  yttStringField(match, "namespace"),
+		})
+	}
+
+	return sensitivity
+}
+
+func (s yttSensitivity) IsSensitive(ref yttDocumentRef) bool {
+	for _, match := range s.matches {
+		if match.Matches(ref) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s yttSensitivity) Partition(docSet *yamlmeta.DocumentSet) (*yamlmeta.DocumentSet, *yamlmeta.DocumentSet) {
+	sensitive := &yamlmeta.DocumentSet{}
+	nonSensitive := &yamlmeta.DocumentSet{}
+
+	for _, doc := range docSet.Items {
+		if doc.IsEmpty() {
+			continue
+		}
+
+		if s.IsSensitive(newYttDocumentRef(yttUnorderedValue(doc.AsInterface()))) {
+			sensitive.Items = append(sensitive.Items, doc)
+		} else {
+			nonSensitive.Items = append(nonSensitive.Items, doc)
+		}
+	}
+
+	return sensitive, nonSensitive
+}
+
+func yttStringField(obj map[string]interface{}, key string) string {
+	if val, ok := obj[key].(string); ok {
+		return val
+	}
+	return ""
+}
+
+// yttApplyFileMarks goes through ytt's own flag handling so that marks
+// behave exactly like --file-mark on the CLI
+func yttApplyFileMarks(files []*filespkg.File, fileMarks []interface{}) ([]*filespkg.File, error) {
+	if len(fileMarks) == 0 {
+		return files, nil
+	}
+
+	fileMarksOpts := template.FileMarksOpts{}
+
+	cmd := &cobra.Command{}
+	fileMarksOpts.Set(cmd)
+
+	for _, fileMark := range fileMarks {
+		err := cmd.Flags().Set("file-mark", fileMark.(string))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return fileMarksOpts.Apply(files)
+}
+
+// yttResolvePaths makes local paths relative to baseDir, expands glob
+// patterns and downloads URLs, keeping ytt's 'relative/path=path' syntax.
+func yttResolvePaths(baseDir string, paths []string, fetcher *util.HTTPFetcher) ([]string, error) {
+	var result []string
+
+	for _, path := range paths {
+		relativePath := ""
+
+		// URLs may contain '=' in query or checksum fragment
+		if !util.IsHTTPSource(path) {
+			pathPieces := strings.SplitN(path, "=", 2)
+			if len(pathPieces) == 2 {
+				relativePath = pathPieces[0] + "="
+				path = pathPieces[1]
+			}
+		}
+
+		if util.IsHTTPSource(path) {
+			localPath, err := fetcher.Fetch(path)
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, relativePath+localPath)
+			continue
+		}
+
+		resolvedPath := path
+		if baseDir != "" && !filepath.IsAbs(path) {
+			resolvedPath = filepath.Join(baseDir, path)
+		}
+
+		matches, err := filepath.Glob(resolvedPath)
+		if err != nil {
+			return nil, fmt.Errorf("Expected file '%s' to be a valid path or glob pattern: %s", path, err)
+		}
+
+		if len(matches) == 0 {
+			if resolvedPath != path {
+				return nil, fmt.Errorf("Expected file '%s' (resolved to '%s') to exist", path, resolvedPath)
+			}
+			return nil, fmt.Errorf("Expected file '%s' to exist", path)
+		}
+
+		if len(matches) > 1 && relativePath != "" {
+			return nil, fmt.Errorf("Expected file '%s' with relative path assignment to match a single path, but matched %d", path, len(matches))
+		}
+
+		for _, match := range matches {
+			result = append(result, relativePath+match)
+		}
+	}
+
+	return result, nil
+}
+
+func yttFileSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Description: "Inline file that takes part in library and load resolution under the given path",
+		Optional:    true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"path": {
+					Type:        schema.TypeString,
+					Description: "Relative path of the file (e.g. config/helpers.lib.yml)",
+					Required:    true,
+				},
+				"content": {
+					Type:        schema.TypeString,
+					Description: "Contents of the file",
+					Required:    true,
+				},
+			},
+		},
+	}
+}
+
+// yttInlineFiles builds files from file blocks, placing them under pathPrefix
+func yttInlineFiles(fileParams []interface{}, pathPrefix string) ([]*filespkg.File, error) {
+	var files []*filespkg.File
+
+	seenPaths := map[string]struct{}{}
+
+	for _, fileParam := range fileParams {
+		fileSpec := fileParam.(map[string]interface{})
+
+		path := filepath.ToSlash(filepath.Clean(fileSpec["path"].(string)))
+		if path == "." || filepath.IsAbs(path) || strings.HasPrefix(path, "../") {
+			return nil, fmt.Errorf("Expected file path '%s' to be relative", fileSpec["path"])
+		}
+
+		if _, found := seenPaths[path]; found {
+			return nil, fmt.Errorf("Expected file path '%s' to be unique", path)
+		}
+		seenPaths[path] = struct{}{}
+
+		file, err := filespkg.NewFileFromSource(filespkg.NewCachedSource(
+			filespkg.NewBytesSource(pathpkg.Join(pathPrefix, path), []byte(fileSpec["content"].(string)))))
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// yttValuesFiles is yttKVs for values_files, with relative paths resolved
+// against baseDir (ytt itself reads them relative to the working directory)
+func yttValuesFiles(d yttResourceGetter, baseDir string) ([]string, error) {
+	var kvs []string
+
+	for _, kv := range yttKVs(d, "values_files") {
+		pieces := strings.SplitN(kv, "=", 2)
+		key, path := pieces[0], pieces[1]
+
+		resolvedPath := path
+		if baseDir != "" && !filepath.IsAbs(path) {
+			resolvedPath = filepath.Join(baseDir, path)
+		}
+
+		_, err := os.Stat(resolvedPath)
+		if err != nil {
+			if resolvedPath != path {
+				return nil, fmt.Errorf("Expected values_files '%s' file '%s' (resolved to '%s') to exist: %s", key, path, resolvedPath, err)
+			}
+			return nil, fmt.Errorf("Expected values_files '%s' file '%s' to exist: %s", key, path, err)
+		}
+
+		kvs = append(kvs, key+"="+resolvedPath)
+	}
+
+	return kvs, nil
+}
+
+// yttKVs converts a map attribute into ytt key=value flags. Keys are sorted
+// so that overlays are applied in a stable order and nested keys
+// (e.g. a.b) are applied after their parents (e.g. a).
+func yttKVs(d yttResourceGetter, key string) []string {
+	values := d.Get(key).(map[string]interface{})
+
+	var keys []string
+	for k := range values {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	var kvs []string
+	for _, k := range keys {
+		kvs = append(kvs, k+"="+values[k].(string))
+	}
+
+	return kvs
+}
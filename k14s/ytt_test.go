@@ -0,0 +1,703 @@
+package k14s
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	util "github.com/niallthomson/terraform-provider-k14s/k14s/util"
+)
+
+func yttTestRender(t *testing.T, inputs yttBlockGetter) (*yttRenderResult, error) {
+	t.Helper()
+
+	cacheDir, err := ioutil.TempDir("", "ytt-test-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	return yttRender(inputs, util.NewHTTPFetcher(time.Second, cacheDir))
+}
+
+func TestYttIgnoreUnknownComments(t *testing.T) {
+	config := "# plain comment\nkey: value\n"
+
+	result, err := yttTestRender(t, yttBlockGetter{"config_yaml": []interface{}{config}})
+	if err != nil {
+		t.Fatalf("Expected unknown comments to be ignored by default: %s", err)
+	}
+	if result.Attributes["result"] != "key: value\n" {
+		t.Fatalf("Expected comment to be dropped, but was: %s", result.Attributes["result"])
+	}
+
+	_, err = yttTestRender(t, yttBlockGetter{
+		"config_yaml":             []interface{}{config},
+		"ignore_unknown_comments": false,
+	})
+	if err == nil || !strings.Contains(err.Error(), "comment") {
+		t.Fatalf("Expected plain comment to fail with ignore_unknown_comments = false, but was: %v", err)
+	}
+
+	_, err = yttTestRender(t, yttBlockGetter{
+		"config_yaml":             []interface{}{"#! ytt comment\nkey: value\n"},
+		"ignore_unknown_comments": false,
+	})
+	if err != nil {
+		t.Fatalf("Expected ytt comment to be allowed with ignore_unknown_comments = false: %s", err)
+	}
+}
+
+func TestYttStrict(t *testing.T) {
+	config := "key: yes\n"
+
+	result, err := yttTestRender(t, yttBlockGetter{"config_yaml": []interface{}{config}})
+	if err != nil {
+		t.Fatalf("Expected non-strict YAML to be accepted by default: %s", err)
+	}
+	if result.Attributes["result"] != "key: true\n" {
+		t.Fatalf("Expected yes to be parsed as boolean, but was: %s", result.Attributes["result"])
+	}
+
+	_, err = yttTestRender(t, yttBlockGetter{
+		"config_yaml": []interface{}{config},
+		"strict":      true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "Strict parsing") {
+		t.Fatalf("Expected non-strict template YAML to fail with strict = true, but was: %v", err)
+	}
+
+	valuesConfig := []interface{}{
+		"#@data/values\n---\nkey: default\n",
+		"#@ load(\"@ytt:data\", \"data\")\n---\nkey: #@ data.values.key\n",
+	}
+
+	result, err = yttTestRender(t, yttBlockGetter{
+		"config_yaml": valuesConfig,
+		"values_yaml": map[string]interface{}{"key": "yes"},
+	})
+	if err != nil {
+		t.Fatalf("Expected non-strict data value YAML to be accepted by default: %s", err)
+	}
+	if result.Attributes["result"] != "key: true\n" {
+		t.Fatalf("Expected data value yes to be parsed as boolean, but was: %s", result.Attributes["result"])
+	}
+
+	_, err = yttTestRender(t, yttBlockGetter{
+		"config_yaml": valuesConfig,
+		"values_yaml": map[string]interface{}{"key": "yes"},
+		"strict":      true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "Strict parsing") {
+		t.Fatalf("Expected non-strict data value YAML to fail with strict = true, but was: %v", err)
+	}
+
+	_, err = yttTestRender(t, yttBlockGetter{
+		"config_yaml": []interface{}{"key: \"yes\"\n"},
+		"strict":      true,
+	})
+	if err != nil {
+		t.Fatalf("Expected strict YAML to be accepted with strict = true: %s", err)
+	}
+}
+
+// setEnv sets env vars for the test process and returns a function
+// restoring the previous values
+func setEnv(env map[string]string) func() {
+	prevEnv := map[string]*string{}
+
+	for key, val := range env {
+		if prevVal, found := os.LookupEnv(key); found {
+			prevEnv[key] = &prevVal
+		} else {
+			prevEnv[key] = nil
+		}
+		os.Setenv(key, val)
+	}
+
+	return func() {
+		for key, prevVal := range prevEnv {
+			if prevVal == nil {
+				os.Unsetenv(key)
+			} else {
+				os.Setenv(key, *prevVal)
+			}
+		}
+	}
+}
+
+func TestYttValuesEnv(t *testing.T) {
+	restoreEnv := setEnv(map[string]string{
+		"K14SX_TEST_STR_flag":         "true",
+		"K14SX_TEST_STR_nested__port": "8080",
+		"K14SX_TEST_YAML_count":       "3",
+		"K14SX_TEST_YAML_list":        "[a, b]",
+		"K14SX_TEST_OVERRIDE_name":    "from-env",
+	})
+	defer restoreEnv()
+
+	valuesConfig := []interface{}{
+		"#@data/values\n---\nflag: false\ncount: 0\nlist: []\nname: default\nnested:\n  port: 0\n",
+		"#@ load(\"@ytt:data\", \"data\")\n---\nvalues: #@ data.values\n",
+	}
+
+	result, err := yttTestRender(t, yttBlockGetter{
+		"config_yaml":            valuesConfig,
+		"values_env_prefix":      []interface{}{"K14SX_TEST_STR", "K14SX_TEST_OVERRIDE"},
+		"values_env_yaml_prefix": []interface{}{"K14SX_TEST_YAML"},
+	})
+	if err != nil {
+		t.Fatalf("Expected render to succeed: %s", err)
+	}
+
+	// String env values stay strings, YAML env values are typed
+	expectedJSON := `{"count":3,"flag":"true","list":["a","b"],"name":"from-env","nested":{"port":"8080"}}`
+
+	if result.Attributes["data_values_json"] != expectedJSON {
+		t.Fatalf("Expected data values %s, but was %s", expectedJSON, result.Attributes["data_values_json"])
+	}
+
+	// values take precedence over env vars regardless of type
+	result, err = yttTestRender(t, yttBlockGetter{
+		"config_yaml":            valuesConfig,
+		"values_env_prefix":      []interface{}{"K14SX_TEST_OVERRIDE"},
+		"values_env_yaml_prefix": []interface{}{"K14SX_TEST_YAML"},
+		"values":                 map[string]interface{}{"name": "from-values"},
+		"values_yaml":            map[string]interface{}{"count": "5"},
+	})
+	if err != nil {
+		t.Fatalf("Expected render to succeed: %s", err)
+	}
+
+	values := result.Attributes["data_values_json"].(string)
+	if !strings.Contains(values, `"name":"from-values"`) || !strings.Contains(values, `"count":5`) {
+		t.Fatalf("Expected values to override env vars, but was %s", values)
+	}
+
+	restoreInvalidEnv := setEnv(map[string]string{"K14SX_TEST_YAML_list": "[unclosed"})
+	defer restoreInvalidEnv()
+
+	_, err = yttTestRender(t, yttBlockGetter{
+		"config_yaml":            valuesConfig,
+		"values_env_yaml_prefix": []interface{}{"K14SX_TEST_YAML"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "K14SX_TEST_YAML_list") {
+		t.Fatalf("Expected invalid YAML env value to fail, but was: %v", err)
+	}
+}
+
+func TestYttDataValuesSensitivity(t *testing.T) {
+	restoreEnv := setEnv(map[string]string{"K14SX_TEST_SECRET_password": "from-env"})
+	defer restoreEnv()
+
+	valuesConfig := []interface{}{"#@data/values\n---\nname: default\npassword: \"\"\n"}
+
+	result, err := yttTestRender(t, yttBlockGetter{
+		"config_yaml": valuesConfig,
+		"values":      map[string]interface{}{"name": "from-values"},
+	})
+	if err != nil {
+		t.Fatalf("Expected render to succeed: %s", err)
+	}
+
+	if result.Attributes["data_values_nonsensitive"] != "name: from-values\npassword: \"\"\n" {
+		t.Fatalf("Expected values from config to be non-sensitive, but was %q", result.Attributes["data_values_nonsensitive"])
+	}
+
+	if result.Attributes["data_values_defaults"] != "name: default\npassword: \"\"\n" {
+		t.Fatalf("Expected declared data values, but was %q", result.Attributes["data_values_defaults"])
+	}
+
+	result, err = yttTestRender(t, yttBlockGetter{
+		"config_yaml":       valuesConfig,
+		"values_env_prefix": []interface{}{"K14SX_TEST_SECRET"},
+	})
+	if err != nil {
+		t.Fatalf("Expected render to succeed: %s", err)
+	}
+
+	if result.Attributes["data_values_nonsensitive"] != "" {
+		t.Fatalf("Expected values from env vars to only be sensitive, but was %q", result.Attributes["data_values_nonsensitive"])
+	}
+
+	if !strings.Contains(result.Attributes["data_values"].(string), "from-env") {
+		t.Fatalf("Expected sensitive values to include env vars, but was %q", result.Attributes["data_values"])
+	}
+
+	if strings.Contains(result.Attributes["data_values_defaults"].(string), "from-env") {
+		t.Fatalf("Expected declared data values to exclude env vars, but was %q", result.Attributes["data_values_defaults"])
+	}
+}
+
+func TestYttValuesFilesBaseDir(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "ytt-test-base-dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	err = ioutil.WriteFile(filepath.Join(baseDir, "name.txt"), []byte("from-file"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valuesConfig := []interface{}{
+		"#@data/values\n---\nname: default\n",
+		"#@ load(\"@ytt:data\", \"data\")\n---\nname: #@ data.values.name\n",
+	}
+
+	for _, path := range []string{"name.txt", filepath.Join(baseDir, "name.txt")} {
+		result, err := yttTestRender(t, yttBlockGetter{
+			"config_yaml":  valuesConfig,
+			"base_dir":     baseDir,
+			"values_files": map[string]interface{}{"name": path},
+		})
+		if err != nil {
+			t.Fatalf("Expected values file '%s' to be resolved against base_dir: %s", path, err)
+		}
+		if result.Attributes["result"] != "name: from-file\n" {
+			t.Fatalf("Expected data value from file, but was: %s", result.Attributes["result"])
+		}
+	}
+
+	_, err = yttTestRender(t, yttBlockGetter{
+		"config_yaml":  valuesConfig,
+		"base_dir":     baseDir,
+		"values_files": map[string]interface{}{"name": "missing.txt"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "values_files 'name'") || !strings.Contains(err.Error(), filepath.Join(baseDir, "missing.txt")) {
+		t.Fatalf("Expected missing values file to fail with its resolved path, but was: %v", err)
+	}
+}
+
+func yttTestLibrary(name string, extra map[string]interface{}) map[string]interface{} {
+	library := map[string]interface{}{
+		"name": name,
+		"path": "",
+		"file": []interface{}{
+			map[string]interface{}{
+				"path":    "values.yml",
+				"content": "#@data/values\n---\nname: default\nreplicas: 1\n",
+			},
+			map[string]interface{}{
+				"path":    "config.yml",
+				"content": "#@ load(\"@ytt:data\", \"data\")\n---\nname: #@ data.values.name\nreplicas: #@ data.values.replicas\n",
+			},
+		},
+		"values":      map[string]interface{}{},
+		"values_yaml": "",
+	}
+
+	for key, val := range extra {
+		library[key] = val
+	}
+
+	return library
+}
+
+func TestYttLibraryDataValues(t *testing.T) {
+	library := yttTestLibrary("github.com/org/app", map[string]interface{}{
+		"values":      map[string]interface{}{"name": "from-values"},
+		"values_yaml": "replicas: 2\n",
+	})
+
+	result, err := yttTestRender(t, yttBlockGetter{
+		"library": []interface{}{library},
+		"config_yaml": []interface{}{
+			"#@ load(\"/k14sx-library.star\", \"library\")\n#@ load(\"@ytt:template\", \"template\")\n--- #@ template.replace(library.get(\"github.com/org/app\").eval())\n",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected render to succeed: %s", err)
+	}
+
+	if result.Attributes["result"] != "name: from-values\nreplicas: 2\n" {
+		t.Fatalf("Expected library data values to be applied, but was %q", result.Attributes["result"])
+	}
+
+	// Templates can still override, and @ytt:library is left untouched
+	result, err = yttTestRender(t, yttBlockGetter{
+		"library": []interface{}{library},
+		"config_yaml": []interface{}{
+			"#@ load(\"/k14sx-library.star\", \"library\")\n#@ load(\"@ytt:template\", \"template\")\n--- #@ template.replace(library.get(\"github.com/org/app\").with_data_values({\"replicas\": 3}).eval())\n",
+			"#@ load(\"@ytt:library\", \"library\")\n#@ load(\"@ytt:template\", \"template\")\n--- #@ template.replace(library.get(\"github.com/org/app\").eval())\n",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected render to succeed: %s", err)
+	}
+
+	expected := "name: from-values\nreplicas: 3\n---\nname: default\nreplicas: 1\n"
+	if result.Attributes["result"] != expected {
+		t.Fatalf("Expected template data values to be applied last, but was %q", result.Attributes["result"])
+	}
+}
+
+func TestYttLibraryPath(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "ytt-test-library")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	err = os.Mkdir(filepath.Join(baseDir, "lib"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(baseDir, "lib", "helpers.star"), []byte("def greet(name):\n  return \"hello \" + name\nend\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	library := yttTestLibrary("helpers", map[string]interface{}{"path": "lib", "file": []interface{}{}})
+
+	result, err := yttTestRender(t, yttBlockGetter{
+		"base_dir": baseDir,
+		"library":  []interface{}{library},
+		"config_yaml": []interface{}{
+			"#@ load(\"@helpers:helpers.star\", \"greet\")\n---\ngreeting: #@ greet(\"world\")\n",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected render to succeed: %s", err)
+	}
+
+	if result.Attributes["result"] != "greeting: hello world\n" {
+		t.Fatalf("Expected library directory to be loadable, but was %q", result.Attributes["result"])
+	}
+}
+
+func TestYttLibraryNames(t *testing.T) {
+	for _, name := range []string{"", ".", "..", "../lib", "/lib", "lib/../other", "lib/", "lib//other"} {
+		_, err := yttTestRender(t, yttBlockGetter{
+			"library": []interface{}{yttTestLibrary(name, nil)},
+		})
+		if err == nil || !strings.Contains(err.Error(), "clean relative path") {
+			t.Fatalf("Expected library name '%s' to be rejected, but was: %v", name, err)
+		}
+	}
+
+	_, err := yttTestRender(t, yttBlockGetter{
+		"library": []interface{}{yttTestLibrary("lib", nil), yttTestLibrary("lib", nil)},
+	})
+	if err == nil || !strings.Contains(err.Error(), "to be unique") {
+		t.Fatalf("Expected duplicate library name to be rejected, but was: %v", err)
+	}
+}
+
+func yttTestFile(path, content string) map[string]interface{} {
+	return map[string]interface{}{"path": path, "content": content}
+}
+
+func TestYttNamedFiles(t *testing.T) {
+	result, err := yttTestRender(t, yttBlockGetter{
+		"file": []interface{}{
+			yttTestFile("helpers/names.star", "def prefixed(name):\n  return \"app-\" + name\nend\n"),
+			yttTestFile("helpers/labels.lib.yml", "#@ def labels():\napp: web\n#@ end\n"),
+			yttTestFile("config/greeting.txt", "hello"),
+			yttTestFile("config/web.yml", "#@ load(\"/helpers/names.star\", \"prefixed\")\n#@ load(\"/helpers/labels.lib.yml\", \"labels\")\n#@ load(\"@ytt:data\", \"data\")\n---\nname: #@ prefixed(\"web\")\nlabels: #@ labels()\ngreeting: #@ data.read(\"greeting.txt\")\n"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected render to succeed: %s", err)
+	}
+
+	expected := "name: app-web\nlabels:\n  app: web\ngreeting: hello\n"
+	if result.Attributes["result"] != expected {
+		t.Fatalf("Expected named files to be loadable, but was %q", result.Attributes["result"])
+	}
+
+	// Errors point at the file they come from
+	_, err = yttTestRender(t, yttBlockGetter{
+		"file": []interface{}{yttTestFile("config/broken.yml", "---\nkey: #@ undefined_symbol\n")},
+	})
+	if err == nil || !strings.Contains(err.Error(), "config/broken.yml") {
+		t.Fatalf("Expected error to name the file, but was: %v", err)
+	}
+
+	for _, path := range []string{"/abs.yml", "../outside.yml", "."} {
+		_, err = yttTestRender(t, yttBlockGetter{"file": []interface{}{yttTestFile(path, "")}})
+		if err == nil || !strings.Contains(err.Error(), "to be relative") {
+			t.Fatalf("Expected file path '%s' to be rejected, but was: %v", path, err)
+		}
+	}
+
+	_, err = yttTestRender(t, yttBlockGetter{
+		"file": []interface{}{yttTestFile("a.yml", ""), yttTestFile("./a.yml", "")},
+	})
+	if err == nil || !strings.Contains(err.Error(), "to be unique") {
+		t.Fatalf("Expected duplicate file path to be rejected, but was: %v", err)
+	}
+}
+
+const yttTestDocuments = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: apps
+data:
+  key: value
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: creds
+stringData:
+  password: hunter2
+`
+
+func TestYttDocumentsAndOutputFiles(t *testing.T) {
+	result, err := yttTestRender(t, yttBlockGetter{
+		"config_yaml": []interface{}{yttTestDocuments},
+		"file": []interface{}{
+			yttTestFile("notes/readme.txt", "(@= \"generated\" @) notes"),
+			yttTestFile("empty.yml", "#! only a comment\n"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected render to succeed: %s", err)
+	}
+
+	documents := result.Attributes["documents"].([]interface{})
+	if len(documents) != 2 {
+		t.Fatalf("Expected empty documents to be skipped, but was %d documents", len(documents))
+	}
+
+	configMap := documents[0].(map[string]interface{})
+	expectedMeta := map[string]interface{}{"api_version": "v1", "kind": "ConfigMap", "name": "config", "namespace": "apps"}
+	for key, val := range expectedMeta {
+		if configMap[key] != val {
+			t.Fatalf("Expected document %s to be %s, but was %s", key, val, configMap[key])
+		}
+	}
+
+	if configMap["yaml"] != "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n  namespace: apps\ndata:\n  key: value\n" {
+		t.Fatalf("Expected document YAML, but was %q", configMap["yaml"])
+	}
+
+	if configMap["json"] != `{"apiVersion":"v1","data":{"key":"value"},"kind":"ConfigMap","metadata":{"name":"config","namespace":"apps"}}` {
+		t.Fatalf("Expected document JSON, but was %q", configMap["json"])
+	}
+
+	secret := documents[1].(map[string]interface{})
+	if secret["kind"] != "Secret" || secret["namespace"] != "" {
+		t.Fatalf("Expected second document to be the secret, but was %#v", secret)
+	}
+
+	outputFiles := result.Attributes["output_files"].(map[string]interface{})
+	if outputFiles["notes/readme.txt"] != "generated notes" {
+		t.Fatalf("Expected text template to be an output file, but was %#v", outputFiles)
+	}
+}
+
+func TestYttOutputFormats(t *testing.T) {
+	// Keys are out of order and include a non-string key
+	config := "---\nkind: ConfigMap\napiVersion: v1\ndata:\n  b: 2\n  a: 1\n  true: yes\n---\n---\nkind: Namespace\n"
+
+	expected := map[string]string{
+		yttOutputFormatJSON:          `[{"apiVersion":"v1","data":{"a":1,"b":2,"true":true},"kind":"ConfigMap"},{"kind":"Namespace"}]`,
+		yttOutputFormatJSONDocuments: "{\"apiVersion\":\"v1\",\"data\":{\"a\":1,\"b\":2,\"true\":true},\"kind\":\"ConfigMap\"}\n{\"kind\":\"Namespace\"}\n",
+	}
+
+	for format, expectedResult := range expected {
+		result, err := yttTestRender(t, yttBlockGetter{
+			"config_yaml":   []interface{}{config},
+			"output_format": format,
+		})
+		if err != nil {
+			t.Fatalf("Expected %s render to succeed: %s", format, err)
+		}
+
+		if result.Attributes["result"] != expectedResult {
+			t.Fatalf("Expected %s result %q, but was %q", format, expectedResult, result.Attributes["result"])
+		}
+	}
+
+	result, err := yttTestRender(t, yttBlockGetter{
+		"config_yaml":   []interface{}{"---\n"},
+		"output_format": yttOutputFormatJSON,
+	})
+	if err != nil {
+		t.Fatalf("Expected render to succeed: %s", err)
+	}
+
+	if result.Attributes["result"] != "[]" {
+		t.Fatalf("Expected no documents to be an empty JSON array, but was %q", result.Attributes["result"])
+	}
+}
+
+func TestYttSensitivePartition(t *testing.T) {
+	config := yttTestDocuments + "---\napiVersion: example.com/v1\nkind: Credential\nmetadata:\n  name: db\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: tokens\n  namespace: apps\n"
+
+	result, err := yttTestRender(t, yttBlockGetter{
+		"config_yaml":     []interface{}{config},
+		"sensitive_kinds": []interface{}{"Credential"},
+		"sensitive_match": []interface{}{map[string]interface{}{"kind": "ConfigMap", "name": "tokens", "api_version": "", "namespace": ""}},
+	})
+	if err != nil {
+		t.Fatalf("Expected render to succeed: %s", err)
+	}
+
+	sensitive := result.Attributes["result_sensitive"].(string)
+	for _, name := range []string{"creds", "db", "tokens"} {
+		if !strings.Contains(sensitive, "name: "+name+"\n") {
+			t.Fatalf("Expected '%s' to be sensitive, but was %q", name, sensitive)
+		}
+	}
+
+	nonSensitive := result.Attributes["result_nonsensitive"].(string)
+	if nonSensitive != "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n  namespace: apps\ndata:\n  key: value\n" {
+		t.Fatalf("Expected only 'config' to be non-sensitive, but was %q", nonSensitive)
+	}
+
+	var sensitiveFlags []bool
+	for _, document := range result.Attributes["documents"].([]interface{}) {
+		sensitiveFlags = append(sensitiveFlags, document.(map[string]interface{})["sensitive"].(bool))
+	}
+
+	if fmt.Sprint(sensitiveFlags) != "[false true true true]" {
+		t.Fatalf("Expected documents to be flagged like the partition, but was %v", sensitiveFlags)
+	}
+
+	// result still holds all documents, and an empty match block matches everything
+	if !strings.Contains(result.Attributes["result"].(string), "hunter2") {
+		t.Fatalf("Expected result to hold all documents")
+	}
+
+	result, err = yttTestRender(t, yttBlockGetter{
+		"config_yaml":     []interface{}{yttTestDocuments},
+		"sensitive_match": []interface{}{nil},
+	})
+	if err != nil {
+		t.Fatalf("Expected render to succeed: %s", err)
+	}
+
+	if result.Attributes["result_nonsensitive"] != "" {
+		t.Fatalf("Expected empty match block to make everything sensitive, but was %q", result.Attributes["result_nonsensitive"])
+	}
+}
+
+func TestYttFilesResolution(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "ytt-test-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(baseDir)
+
+	err = os.MkdirAll(filepath.Join(baseDir, "config", "nested"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testFiles := map[string]string{
+		"config/a.yml":        "a: 1\n",
+		"config/nested/b.yml": "b: 2\n",
+		"c.yml":               "c: 3\n",
+		"d.yml":               "d: 4\n",
+		"ignored.txt":         "ignored",
+	}
+
+	for path, content := range testFiles {
+		err = ioutil.WriteFile(filepath.Join(baseDir, path), []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Directories are walked and globs expanded relative to base_dir
+	result, err := yttTestRender(t, yttBlockGetter{
+		"base_dir": baseDir,
+		"files":    []interface{}{"config", "[cd].yml"},
+	})
+	if err != nil {
+		t.Fatalf("Expected render to succeed: %s", err)
+	}
+
+	if result.Attributes["result"] != "a: 1\n---\nb: 2\n---\nc: 3\n---\nd: 4\n" {
+		t.Fatalf("Expected directory and glob matches, but was %q", result.Attributes["result"])
+	}
+
+	// Absolute paths ignore base_dir
+	result, err = yttTestRender(t, yttBlockGetter{
+		"base_dir": os.TempDir(),
+		"files":    []interface{}{filepath.Join(baseDir, "c.yml")},
+	})
+	if err != nil {
+		t.Fatalf("Expected render to succeed: %s", err)
+	}
+
+	if result.Attributes["result"] != "c: 3\n" {
+		t.Fatalf("Expected absolute path to be used as is, but was %q", result.Attributes["result"])
+	}
+
+	_, err = yttTestRender(t, yttBlockGetter{
+		"base_dir": baseDir,
+		"files":    []interface{}{"missing.yml"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "'missing.yml' (resolved to '"+filepath.Join(baseDir, "missing.yml")+"') to exist") {
+		t.Fatalf("Expected missing file to be reported with its resolved path, but was: %v", err)
+	}
+
+	_, err = yttTestRender(t, yttBlockGetter{
+		"base_dir": baseDir,
+		"files":    []interface{}{"renamed.yml=*.yml"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "to match a single path, but matched 2") {
+		t.Fatalf("Expected relative path assignment to require a single match, but was: %v", err)
+	}
+
+	// Paths fail before inline files are considered
+	_, err = yttTestRender(t, yttBlockGetter{
+		"files":       []interface{}{filepath.Join(baseDir, "missing.yml")},
+		"config_yaml": []interface{}{"#@ invalid"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "missing.yml") {
+		t.Fatalf("Expected missing file to be reported first, but was: %v", err)
+	}
+}
+
+func TestYttFileMarks(t *testing.T) {
+	files := []interface{}{
+		yttTestFile("config/app.yml", "#@ load(\"@ytt:data\", \"data\")\n---\nname: #@ data.read(\"name.txt\")\nsettings: #@ data.read(\"settings.yml\")\n"),
+		yttTestFile("config/name.txt", "web"),
+		yttTestFile("config/settings.yml", "replicas: 2\n"),
+		yttTestFile("config/plain.yml", "literal: #@ not evaluated\n"),
+		yttTestFile("scratch/notes.yml", "broken: [\n"),
+	}
+
+	result, err := yttTestRender(t, yttBlockGetter{
+		"file": files,
+		"file_marks": []interface{}{
+			"config/*.txt:type=data",
+			"config/settings.yml:type=data",
+			"config/plain.yml:type=yaml-plain",
+			"scratch/**/*:exclude=true",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected render to succeed: %s", err)
+	}
+
+	// As a template, the annotation in plain.yml would fail to evaluate
+	expected := "name: web\nsettings: |\n  replicas: 2\n---\nliteral: null\n"
+	if result.Attributes["result"] != expected {
+		t.Fatalf("Expected file marks to be applied, but was %q", result.Attributes["result"])
+	}
+
+	if len(result.Attributes["output_files"].(map[string]interface{})) != 2 {
+		t.Fatalf("Expected data files to not be output, but was %#v", result.Attributes["output_files"])
+	}
+
+	_, err = yttTestRender(t, yttBlockGetter{
+		"file":       files,
+		"file_marks": []interface{}{"config/app.yml"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "config/app.yml") {
+		t.Fatalf("Expected invalid file mark to fail, but was: %v", err)
+	}
+}